@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const commandCheck = "check"
+
+const checkUsage = `usage: gocovdedup check [options] [<file1> <file2> ... <fileN>|-]
+checks the statement coverage of the merged profiles against the minimums
+exits with code 2 when any minimum is not met`
+
+// processCheckArgs parses the check command line, returning the merger
+// holding the profiles.
+func processCheckArgs(args []string, stdIn io.Reader) (*options, *covmerge.Merger, error) {
+	opts := &options{}
+	flags := newMergeFlags("gocovdedup check", opts)
+	addThresholdFlags(flags, opts)
+
+	if err := parseFlags(checkUsage, flags, args); err != nil {
+		return nil, nil, err
+	}
+
+	if flags.NArg() == 0 {
+		return nil, nil, usage(checkUsage, flags, errNoProfiles)
+	}
+
+	if opts.minTotal < 0 || opts.minTotal > 100 {
+		return nil, nil, fmt.Errorf("invalid coverage percentage %v", opts.minTotal)
+	}
+
+	if opts.minTotal == 0 && len(opts.minPackage) == 0 && len(opts.minFile) == 0 {
+		return nil, nil, usage(checkUsage, flags, errors.New("no minimums given, use -min, -min-package or -min-file"))
+	}
+
+	merger, err := newMerger(opts, flags.Args(), stdIn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, merger, nil
+}
+
+// printCheck writes the total statement coverage that passed the minimums.
+func printCheck(profiles []*cover.Profile, w io.Writer) {
+	var total stmtCount
+	for _, profile := range profiles {
+		total.add(profile)
+	}
+	fmt.Fprintf(w, "coverage %.1f%% of %d statements meets the minimums\n", total.percent(), total.total)
+}
+
+// runCheck runs the check command, failing with a thresholdError when a
+// minimum is not met.
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, merger, err := processCheckArgs(args, stdin)
+	if err != nil {
+		return err
+	}
+
+	merged, err := merger.Merge()
+	printWarnings(opts.warnings, stderr)
+	if err != nil {
+		return err
+	}
+
+	if err := checkThresholds(fileCounts(merged), opts.minTotal, opts.minPackage, opts.minFile); err != nil {
+		return err
+	}
+	printCheck(merged, stdout)
+	return nil
+}
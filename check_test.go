@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runCheck([]string{"check", "-min", "80", "covmerge/testdata/module/sample.out"}, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := "coverage 80.6% of 31 statements meets the minimums\n"
+	if stdout.String() != expected {
+		t.Errorf("expected %s, got %s", expected, stdout.String())
+	}
+}
+
+func TestRunCheckBelowMinimum(t *testing.T) {
+	var stdout bytes.Buffer
+	err := runCheck([]string{"check", "-min-file", "90", "covmerge/testdata/module/sample.out"}, nil, &stdout, &bytes.Buffer{})
+
+	var threshold *thresholdError
+	if !errors.As(err, &threshold) {
+		t.Fatal("expected threshold error", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("unexpected output %s", stdout.String())
+	}
+}
+
+func TestProcessCheckArgsErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		args  []string
+		usage bool
+	}{
+		{"no files", []string{"check", "-min", "50"}, true},
+		{"no minimums", []string{"check", "testdata/cover_1.out"}, true},
+		{"bad min", []string{"check", "-min", "101", "testdata/cover_1.out"}, false},
+		{"missing file", []string{"check", "-min", "50", "testdata/missing.out"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := processCheckArgs(tc.args, nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var usageErr *usageError
+			if errors.As(err, &usageErr) != tc.usage {
+				t.Errorf("unexpected usage %v: %v", tc.usage, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const coberturaDocType = `<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">` + "\n"
+
+// now returns the report timestamp, replaced in tests.
+var now = time.Now
+
+// coberturaCoverage is the root element of a Cobertura report.
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      string             `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity string           `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	FileName   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity string          `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int    `xml:"number,attr"`
+	Hits   int    `xml:"hits,attr"`
+	Branch string `xml:"branch,attr"`
+}
+
+// printCobertura creates a formatter writing the profiles as a Cobertura
+// XML report.  Each file is a class, grouped into packages by the directory
+// of the file.  The report's source is the root of the module of resolver
+// and files are named by their path within it.  Go profiles hold no branch
+// data, so the branch rates are always zero.
+func printCobertura(resolver *covmerge.Resolver) formatter {
+	return func(profiles []*cover.Profile, w io.Writer) error {
+		return writeCobertura(profiles, resolver, w)
+	}
+}
+
+func writeCobertura(profiles []*cover.Profile, resolver *covmerge.Resolver, w io.Writer) error {
+	report := coberturaCoverage{
+		BranchRate: rate(0, 0),
+		Complexity: "0",
+		Version:    "gocovdedup",
+		Timestamp:  now().UnixMilli(),
+		Sources:    []string{"."},
+	}
+	if resolver != nil {
+		report.Sources = []string{resolver.Root()}
+	}
+
+	packages := make(map[string]*coberturaPackage)
+	packageLines := make(map[string][2]int)
+	for _, profile := range profiles {
+		class, covered := newCoberturaClass(profile, sourcePath(resolver, profile.FileName))
+
+		name := path.Dir(profile.FileName)
+		pkg, found := packages[name]
+		if !found {
+			pkg = &coberturaPackage{Name: name, BranchRate: rate(0, 0), Complexity: "0"}
+			packages[name] = pkg
+		}
+		pkg.Classes = append(pkg.Classes, class)
+
+		lines := packageLines[name]
+		packageLines[name] = [2]int{lines[0] + covered, lines[1] + len(class.Lines)}
+		report.LinesCovered += covered
+		report.LinesValid += len(class.Lines)
+	}
+
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pkg := packages[name]
+		lines := packageLines[name]
+		pkg.LineRate = rate(lines[0], lines[1])
+		report.Packages = append(report.Packages, *pkg)
+	}
+	report.LineRate = rate(report.LinesCovered, report.LinesValid)
+
+	if _, err := io.WriteString(w, xml.Header+coberturaDocType); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// newCoberturaClass creates the class of a profile's file, returning it with
+// the number of lines covered.
+func newCoberturaClass(profile *cover.Profile, fileName string) (coberturaClass, int) {
+	class := coberturaClass{
+		Name:       path.Base(profile.FileName),
+		FileName:   fileName,
+		BranchRate: rate(0, 0),
+		Complexity: "0",
+		Lines:      []coberturaLine{},
+	}
+
+	covered := 0
+	hits := covmerge.LineHits(profile)
+	for _, hit := range hits {
+		class.Lines = append(class.Lines, coberturaLine{Number: hit.Line, Hits: hit.Count, Branch: "false"})
+		if hit.Count > 0 {
+			covered++
+		}
+	}
+	class.LineRate = rate(covered, len(hits))
+	return class, covered
+}
+
+// rate formats covered over valid as a Cobertura rate between 0 and 1.
+func rate(covered, valid int) string {
+	if valid == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', -1, 64)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+func TestPrintCobertura(t *testing.T) {
+	now = func() time.Time { return time.UnixMilli(1700000000000) }
+	defer func() { now = time.Now }()
+
+	profiles := []*cover.Profile{
+		{
+			FileName: "github.com/repo/a/b.go",
+			Mode:     covmerge.ModeSet,
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 3, StartCol: 10, EndLine: 4, EndCol: 5, NumStmt: 2, Count: 1},
+				{StartLine: 6, StartCol: 2, EndLine: 6, EndCol: 8, NumStmt: 1, Count: 0},
+			},
+		},
+		{
+			FileName: "github.com/repo/a/c.go",
+			Mode:     covmerge.ModeSet,
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 10, EndLine: 1, EndCol: 20, NumStmt: 1, Count: 1},
+			},
+		},
+		{
+			FileName: "github.com/repo/d/e.go",
+			Mode:     covmerge.ModeSet,
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 8, StartCol: 10, EndLine: 8, EndCol: 20, NumStmt: 1, Count: 0},
+			},
+		},
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage line-rate="0.6" branch-rate="0" lines-covered="3" lines-valid="5" branches-covered="0" branches-valid="0" complexity="0" version="gocovdedup" timestamp="1700000000000">
+	<sources>
+		<source>.</source>
+	</sources>
+	<packages>
+		<package name="github.com/repo/a" line-rate="0.75" branch-rate="0" complexity="0">
+			<classes>
+				<class name="b.go" filename="github.com/repo/a/b.go" line-rate="0.6666666666666666" branch-rate="0" complexity="0">
+					<methods></methods>
+					<lines>
+						<line number="3" hits="1" branch="false"></line>
+						<line number="4" hits="1" branch="false"></line>
+						<line number="6" hits="0" branch="false"></line>
+					</lines>
+				</class>
+				<class name="c.go" filename="github.com/repo/a/c.go" line-rate="1" branch-rate="0" complexity="0">
+					<methods></methods>
+					<lines>
+						<line number="1" hits="1" branch="false"></line>
+					</lines>
+				</class>
+			</classes>
+		</package>
+		<package name="github.com/repo/d" line-rate="0" branch-rate="0" complexity="0">
+			<classes>
+				<class name="e.go" filename="github.com/repo/d/e.go" line-rate="0" branch-rate="0" complexity="0">
+					<methods></methods>
+					<lines>
+						<line number="8" hits="0" branch="false"></line>
+					</lines>
+				</class>
+			</classes>
+		</package>
+	</packages>
+</coverage>
+`
+
+	var buf bytes.Buffer
+	if err := printCobertura(nil)(profiles, &buf); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintCoberturaSources(t *testing.T) {
+	args := []string{"app", "-format", "cobertura", "-src", "covmerge/testdata/module", "covmerge/testdata/module/sample.out", "testdata/cover_1.out"}
+	var stdout bytes.Buffer
+	if err := runMerge(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	root, _ := filepath.Abs("covmerge/testdata/module")
+	for _, expected := range []string{
+		"<source>" + root + "</source>",
+		`<package name="example.com/sample" `,
+		`<class name="sample.go" filename="sample.go" `,
+		`<class name="main.go" filename="github.com/repo/gocovdedup/main.go" `,
+	} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("expected %s in\n%s", expected, stdout.String())
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	testCases := []struct {
+		covered, valid int
+		expected       string
+	}{
+		{0, 0, "0"},
+		{1, 2, "0.5"},
+		{3, 3, "1"},
+	}
+
+	for _, tc := range testCases {
+		if actual := rate(tc.covered, tc.valid); actual != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, actual)
+		}
+	}
+}
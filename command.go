@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const commandHelp = "help"
+
+// command is a gocovdedup subcommand.  The args passed to run start with the
+// command name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// commands lists the subcommands in the order they are documented.
+var commands = []command{
+	{commandMerge, "merge and deduplicate profiles, the default command", runMerge},
+	{commandReport, "print the statement coverage of each package or file", runReport},
+	{commandCheck, "fail when the coverage is below the minimums", runCheck},
+	{commandStats, "print statistics about the inputs and the merged profiles", runStats},
+	{commandDiff, "compare the coverage of a baseline and a new profile", runDiff},
+	{commandPatch, "report the coverage of the lines added by a diff", runPatch},
+	{commandVersion, "print the version and build information", runVersion},
+}
+
+// findCommand returns the command called name.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// mainUsage describes how to run gocovdedup and lists the commands.
+func mainUsage() string {
+	var buf bytes.Buffer
+	buf.WriteString(`usage: gocovdedup <command> [options] [arguments]
+the command may be left out to merge profiles, gocovdedup [options] <file1> ... <fileN>
+
+commands:
+`)
+	tw := tabwriter.NewWriter(&buf, 1, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(tw, "  %s\t%s\n", commandHelp, "print the usage and options of a command")
+	tw.Flush()
+	buf.WriteString("\nrun 'gocovdedup help <command>' for the options of a command")
+	return buf.String()
+}
+
+// run runs the command named by args[1].  When args[1] is not a command the
+// profiles are merged, so they can be given without naming a command.
+// Usage that was asked for is written to stdout.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	err := dispatch(args, stdin, stdout, stderr)
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) && usageErr.err == nil {
+		fmt.Fprintln(stdout, usageErr.usage)
+		return nil
+	}
+	return err
+}
+
+func dispatch(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) < 2 {
+		return &usageError{usage: mainUsage(), err: errors.New("no command or profiles given")}
+	}
+
+	switch args[1] {
+	case "-h", "-help", "--help":
+		return &usageError{usage: mainUsage()}
+	case commandHelp:
+		return runHelp(args[1:])
+	}
+
+	if cmd, found := findCommand(args[1]); found {
+		return cmd.run(args[1:], stdin, stdout, stderr)
+	}
+	return runMerge(args, stdin, stdout, stderr)
+}
+
+// runHelp returns the usage of the command named by args[1], or the main
+// usage when no command is named.
+func runHelp(args []string) error {
+	if len(args) < 2 {
+		return &usageError{usage: mainUsage()}
+	}
+
+	cmd, found := findCommand(args[1])
+	if !found {
+		return &usageError{usage: mainUsage(), err: fmt.Errorf("unknown command %q", args[1])}
+	}
+	return cmd.run([]string{cmd.name, "-h"}, nil, io.Discard, io.Discard)
+}
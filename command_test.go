@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []string
+		stdout string
+		usage  bool
+	}{
+		{"no args", []string{"app"}, "", true},
+		{"help flag", []string{"app", "--help"}, mainUsage() + "\n", false},
+		{"help", []string{"app", "help"}, mainUsage() + "\n", false},
+		{"help command", []string{"app", "help", "version"}, versionUsage + "\n", false},
+		{"help unknown", []string{"app", "help", "nope"}, "", true},
+		{"command help", []string{"app", "stats", "-h"}, "usage: gocovdedup stats", false},
+		{"default merge", []string{"app", "testdata/cover_1.out"}, "mode: set\n", false},
+		{"merge", []string{"app", "merge", "testdata/cover_1.out"}, "mode: set\n", false},
+		{"merge no profiles", []string{"app", "merge"}, "", true},
+		{"merge bad flag", []string{"app", "-bad", "testdata/cover_1.out"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := run(tc.args, nil, &stdout, &bytes.Buffer{})
+
+			var usageErr *usageError
+			if errors.As(err, &usageErr) != tc.usage {
+				t.Errorf("unexpected usage %v: %v", tc.usage, err)
+			}
+			if !tc.usage && err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if !strings.HasPrefix(stdout.String(), tc.stdout) {
+				t.Errorf("expected %s, got %s", tc.stdout, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunHelpEveryCommand(t *testing.T) {
+	for _, cmd := range commands {
+		t.Run(cmd.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := run([]string{"app", cmd.name, "--help"}, nil, &stdout, &bytes.Buffer{}); err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if !strings.HasPrefix(stdout.String(), "usage: gocovdedup") {
+				t.Errorf("unexpected usage %s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestMainUsage(t *testing.T) {
+	text := mainUsage()
+	for _, cmd := range commands {
+		if !strings.Contains(text, "\n  "+cmd.name+" ") {
+			t.Errorf("command %s not listed", cmd.name)
+		}
+	}
+}
+
+func TestUsageError(t *testing.T) {
+	err := &usageError{usage: "usage: gocovdedup"}
+	if err.Error() != "usage: gocovdedup" {
+		t.Errorf("unexpected message %s", err)
+	}
+
+	err = &usageError{usage: "usage: gocovdedup", err: errNoProfiles}
+	if err.Error() != "no profiles given\n\nusage: gocovdedup" || !errors.Is(err, errNoProfiles) {
+		t.Errorf("unexpected message %s", err)
+	}
+}
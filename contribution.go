@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const formatContribution = "contribution"
+
+// contribution is the number of merged statements an input covers, and how
+// many of those no other input covers.
+type contribution struct {
+	name            string
+	covered, unique int
+}
+
+// contributions counts the statements each input covers in the merged profiles.
+func contributions(profiles []*cover.Profile, inputs []covmerge.Input) []contribution {
+	result := make([]contribution, len(inputs))
+	for i, in := range inputs {
+		result[i].name = in.Name
+	}
+
+	for _, profile := range profiles {
+		for i := range profile.Blocks {
+			b := &profile.Blocks[i]
+			if b.NumStmt == 0 {
+				continue
+			}
+
+			hitBy := -1
+			hits := 0
+			for j, in := range inputs {
+				if in.Hits(profile.FileName, b) {
+					result[j].covered += b.NumStmt
+					hitBy = j
+					hits++
+				}
+			}
+			if hits == 1 {
+				result[hitBy].unique += b.NumStmt
+			}
+		}
+	}
+	return result
+}
+
+// printContributions creates a formatter writing the statements each input
+// covers, those only it covers and those the other inputs also cover.  Inputs
+// covering nothing the others do not are marked redundant.
+func printContributions(inputs []covmerge.Input) formatter {
+	return func(profiles []*cover.Profile, w io.Writer) error {
+		tabber := tabwriter.NewWriter(w, 1, 8, 2, ' ', 0)
+
+		var total stmtCount
+		for _, profile := range profiles {
+			total.add(profile)
+		}
+
+		fmt.Fprintln(tabber, "input\tcovered\tunique\tshared")
+		for _, c := range contributions(profiles, inputs) {
+			fmt.Fprintf(tabber, "%s\t%d\t%d\t%d", c.name, c.covered, c.unique, c.covered-c.unique)
+			if c.unique == 0 {
+				fmt.Fprint(tabber, "\tredundant")
+			}
+			fmt.Fprintln(tabber)
+		}
+		fmt.Fprintf(tabber, "total\t%d/%d\t\t\t%.1f%%\n", total.covered, total.total, total.percent())
+
+		return tabber.Flush()
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestContributions(t *testing.T) {
+	dir := t.TempDir()
+	unit := filepath.Join(dir, "unit.out")
+	integration := filepath.Join(dir, "integration.out")
+	e2e := filepath.Join(dir, "e2e.out")
+	writeFile(t, unit, "mode: set\nexample.com/p/a.go:1.1,2.2 2 1\nexample.com/p/a.go:3.1,4.2 1 0\nexample.com/p/a.go:5.1,6.2 3 1\n")
+	writeFile(t, integration, "mode: set\nexample.com/p/a.go:1.1,2.2 2 1\nexample.com/p/a.go:3.1,4.2 1 1\nexample.com/p/a.go:5.1,6.2 3 0\n")
+	writeFile(t, e2e, "mode: set\nexample.com/p/a.go:1.1,2.2 2 1\nexample.com/p/a.go:7.1,7.2 0 1\n")
+
+	opts, profiles, err := mergeArgs([]string{"app", "-format", "contribution", unit, integration, e2e}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []contribution{
+		{name: unit, covered: 5, unique: 3},
+		{name: integration, covered: 3, unique: 1},
+		{name: e2e, covered: 2, unique: 0},
+	}
+	if actual := contributions(profiles, opts.inputs); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestPrintContributions(t *testing.T) {
+	opts, profiles, err := mergeArgs([]string{"app", "-format", "contribution", "covmerge/testdata/module/sample.out", "covmerge/testdata/module/baseline.out", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOutputs(profiles, opts, &buf); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := `input                                  covered  unique  shared
+covmerge/testdata/module/sample.out    25       1       24
+covmerge/testdata/module/baseline.out  28       4       24
+testdata/cover_1.out                   0        0       0  redundant
+total                                  29/39               74.4%
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
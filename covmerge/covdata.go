@@ -0,0 +1,86 @@
+package covmerge
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// goCommand is the go command used to decode binary coverage data.
+var goCommand = "go"
+
+// covMetaMagic is the header of the covmeta files written to GOCOVERDIR.
+var covMetaMagic = []byte{0x00, 'c', 'v', 'm'}
+
+// isCoverDir reports whether dir holds binary coverage data written by a
+// program built with -cover, that is it contains a covmeta file.
+func isCoverDir(dir string) bool {
+	metaFiles, err := filepath.Glob(filepath.Join(dir, "covmeta.*"))
+	if err != nil {
+		return false
+	}
+
+	for _, metaFile := range metaFiles {
+		if hasMagic(metaFile, covMetaMagic) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMagic(file string, magic []byte) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, magic)
+}
+
+// loadCoverDir decodes a binary coverage directory into profiles using go tool covdata.
+func loadCoverDir(dir string) ([]*cover.Profile, error) {
+	file, err := decodeCoverDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file)
+
+	return cover.ParseProfiles(file)
+}
+
+// decodeCoverDir decodes a binary coverage directory with go tool covdata,
+// returning the temporary go cover profile written, which the caller removes.
+func decodeCoverDir(dir string) (string, error) {
+	if !isCoverDir(dir) {
+		return "", fmt.Errorf("%s: directory does not contain binary coverage data", dir)
+	}
+
+	tmp, err := os.CreateTemp("", "gocovdedup-*.out")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(goCommand, "tool", "covdata", "textfmt", "-i="+dir, "-o="+tmp.Name())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp.Name())
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: unable to decode coverage data: %s", dir, msg)
+		}
+		return "", fmt.Errorf("%s: unable to decode coverage data: %w", dir, err)
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,61 @@
+package covmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsCoverDir(t *testing.T) {
+	if !isCoverDir("testdata/covdata") {
+		t.Error("expected cover dir")
+	}
+	if isCoverDir("testdata/module") {
+		t.Error("unexpected cover dir")
+	}
+}
+
+func TestLoadCoverDir(t *testing.T) {
+	profiles, err := loadCoverDir("testdata/covdata")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(profiles) != 2 {
+		t.Fatal("profiles len != 2", len(profiles))
+	}
+
+	if profiles[0].FileName != "example.com/sample/cmd/sample/main.go" || profiles[0].Mode != ModeSet {
+		t.Errorf("unexpected profile %s %s", profiles[0].FileName, profiles[0].Mode)
+	}
+}
+
+func TestLoadCoverDirNotCoverData(t *testing.T) {
+	_, err := loadCoverDir("testdata/module")
+	if err == nil || !strings.Contains(err.Error(), "does not contain binary coverage data") {
+		t.Error("expected not cover data error", err)
+	}
+}
+
+func TestLoadCoverDirToolFailure(t *testing.T) {
+	goCommand = "testdata/notfound"
+	defer func() { goCommand = "go" }()
+
+	if _, err := loadCoverDir("testdata/covdata"); err == nil {
+		t.Error("expected decode error")
+	}
+}
+
+func TestMergeCoverDir(t *testing.T) {
+	m, err := addFiles(Options{}, "testdata/covdata", "testdata/module/sample.out")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(merged) != 2 {
+		t.Fatal("merged len != 2", len(merged))
+	}
+}
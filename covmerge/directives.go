@@ -0,0 +1,200 @@
+package covmerge
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// Coverage exclusion directives.
+const (
+	directiveIgnore      = "//coverage:ignore"
+	directiveIgnoreStart = "//coverage:ignore-start"
+	directiveIgnoreEnd   = "//coverage:ignore-end"
+)
+
+// span is a half open range of source.
+type span struct {
+	start, end position
+}
+
+// contains reports whether the block lies entirely within the span.
+func (s span) contains(b *cover.ProfileBlock) bool {
+	return !(position{b.StartLine, b.StartCol}).before(s.start) && !s.end.before(position{b.EndLine, b.EndCol})
+}
+
+// ignoredSpans finds the source excluded by coverage directives.
+// A //coverage:ignore comment on its own line excludes the declaration or
+// statement that follows it, and at the end of a line it excludes the
+// statement starting on that line.  The span of a statement runs to the
+// start of the following line, where cmd/cover ends its last block.
+// //coverage:ignore-start and //coverage:ignore-end exclude everything
+// between them.
+func ignoredSpans(fileName string, src []byte) ([]span, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := func(p token.Pos) position {
+		at := fset.Position(p)
+		return position{at.Line, at.Column}
+	}
+
+	var spans []span
+	var start *position
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			switch directive(comment.Text) {
+			case directiveIgnoreStart:
+				if start != nil {
+					return nil, fmt.Errorf("%s: nested %s", fset.Position(comment.Pos()), directiveIgnoreStart)
+				}
+				at := pos(comment.Pos())
+				start = &at
+			case directiveIgnoreEnd:
+				if start == nil {
+					return nil, fmt.Errorf("%s: %s without %s", fset.Position(comment.Pos()), directiveIgnoreEnd, directiveIgnoreStart)
+				}
+				spans = append(spans, span{start: *start, end: pos(comment.End())})
+				start = nil
+			case directiveIgnore:
+				if node := ignoredNode(fset, file, comment); node != nil {
+					spans = append(spans, span{start: pos(node.Pos()), end: position{pos(node.End()).line + 1, 1}})
+				}
+			}
+		}
+	}
+	if start != nil {
+		return nil, fmt.Errorf("%s:%d: %s without %s", fileName, start.line, directiveIgnoreStart, directiveIgnoreEnd)
+	}
+
+	return spans, nil
+}
+
+// directive returns the directive in a comment, ignoring any explanation after it.
+func directive(text string) string {
+	if fields := strings.Fields(text); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// ignoredNode finds the declaration or statement a //coverage:ignore comment
+// applies to.  For a trailing comment this is the outermost node starting on
+// the comment's line, otherwise the next statement or declaration in the
+// innermost block holding the comment, or nil when the block has no more.
+func ignoredNode(fset *token.FileSet, file *ast.File, comment *ast.Comment) ast.Node {
+	line := fset.Position(comment.Pos()).Line
+
+	var trailing ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case ast.Decl, ast.Stmt:
+			if trailing == nil && n.Pos() < comment.Pos() && fset.Position(n.Pos()).Line == line {
+				trailing = n
+			}
+		}
+		return trailing == nil
+	})
+	if trailing != nil {
+		return trailing
+	}
+
+	for _, n := range enclosingList(file, comment) {
+		if n.Pos() > comment.Pos() {
+			return n
+		}
+	}
+	return nil
+}
+
+// enclosingList returns the statements or declarations of the innermost
+// block, case clause or file holding the comment.
+func enclosingList(file *ast.File, comment *ast.Comment) []ast.Node {
+	list := make([]ast.Node, 0, len(file.Decls))
+	for _, decl := range file.Decls {
+		list = append(list, decl)
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil || n.Pos() > comment.Pos() || n.End() < comment.End() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = stmtNodes(n.List)
+		case *ast.CaseClause:
+			list = stmtNodes(n.Body)
+		case *ast.CommClause:
+			list = stmtNodes(n.Body)
+		}
+		return true
+	})
+	return list
+}
+
+func stmtNodes(stmts []ast.Stmt) []ast.Node {
+	nodes := make([]ast.Node, len(stmts))
+	for i, stmt := range stmts {
+		nodes[i] = stmt
+	}
+	return nodes
+}
+
+// removeIgnored drops the blocks lying entirely within the ignored spans.
+func removeIgnored(blocks []cover.ProfileBlock, spans []span) []cover.ProfileBlock {
+	if len(spans) == 0 {
+		return blocks
+	}
+
+	kept := make([]cover.ProfileBlock, 0, len(blocks))
+	for i := range blocks {
+		ignored := false
+		for _, s := range spans {
+			if s.contains(&blocks[i]) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			kept = append(kept, blocks[i])
+		}
+	}
+	return kept
+}
+
+// applyDirectives removes the blocks excluded by coverage directives from the
+// merged profiles.  Files that cannot be read or parsed are left unchanged
+// and reported in the returned warnings.
+func applyDirectives(profiles []*cover.Profile, resolver *Resolver) []error {
+	var warnings []error
+	for _, profile := range profiles {
+		file, err := resolver.Resolve(profile.FileName)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+
+		src, err := os.ReadFile(file)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+
+		spans, err := ignoredSpans(file, src)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+
+		profile.Blocks = removeIgnored(profile.Blocks, spans)
+	}
+	return warnings
+}
@@ -0,0 +1,192 @@
+package covmerge
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+const directivesSrc = `package p
+
+//coverage:ignore
+func a() {
+	panic("a")
+}
+
+func b(err error) {
+	if err != nil { //coverage:ignore unreachable
+		panic(err)
+	}
+	//coverage:ignore-start
+	println("one")
+	println("two")
+	//coverage:ignore-end
+}
+`
+
+func TestIgnoredSpans(t *testing.T) {
+	spans, err := ignoredSpans("p.go", []byte(directivesSrc))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []span{
+		{start: position{4, 1}, end: position{7, 1}},
+		{start: position{9, 2}, end: position{12, 1}},
+		{start: position{12, 2}, end: position{15, 23}},
+	}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected %v, got %v", expected, spans)
+	}
+}
+
+func TestIgnoredSpansEnclosingBlock(t *testing.T) {
+	const src = `package p
+
+func c(err error) {
+	if err != nil {
+		println(err)
+		//coverage:ignore
+	}
+	println("after")
+	switch {
+	case err != nil:
+		//coverage:ignore
+		println("case")
+	}
+}
+`
+	spans, err := ignoredSpans("p.go", []byte(src))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []span{
+		{start: position{12, 3}, end: position{13, 1}},
+	}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected %v, got %v", expected, spans)
+	}
+}
+
+func TestIgnoredSpansErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+	}{
+		{"nested", "package p\n//coverage:ignore-start\n//coverage:ignore-start\n//coverage:ignore-end\n"},
+		{"end without start", "package p\n//coverage:ignore-end\n"},
+		{"unterminated", "package p\n//coverage:ignore-start\n"},
+		{"syntax", "package p\nfunc {\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ignoredSpans("p.go", []byte(tc.src)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDirective(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{"//coverage:ignore", directiveIgnore},
+		{"//coverage:ignore because", directiveIgnore},
+		{"//coverage:ignored", "//coverage:ignored"},
+		{"// coverage:ignore", "//"},
+		{"/**/", "/**/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			if actual := directive(tc.text); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRemoveIgnored(t *testing.T) {
+	blocks := []cover.ProfileBlock{
+		{StartLine: 1, StartCol: 10, EndLine: 3, EndCol: 2, NumStmt: 1},
+		{StartLine: 4, StartCol: 1, EndLine: 6, EndCol: 2, NumStmt: 1},
+		{StartLine: 5, StartCol: 1, EndLine: 8, EndCol: 2, NumStmt: 1},
+	}
+	spans := []span{{start: position{4, 1}, end: position{6, 2}}}
+
+	expected := []cover.ProfileBlock{blocks[0], blocks[2]}
+	if actual := removeIgnored(blocks, spans); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if actual := removeIgnored(blocks, nil); !reflect.DeepEqual(actual, blocks) {
+		t.Errorf("expected %v, got %v", blocks, actual)
+	}
+}
+
+func TestApplyDirectives(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/p\n")
+	writeFile(t, filepath.Join(dir, "p.go"), directivesSrc)
+	writeFile(t, filepath.Join(dir, "bad.go"), "package p\n//coverage:ignore-start\n")
+
+	resolver, err := NewResolver(dir)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	blocks := []cover.ProfileBlock{
+		{StartLine: 4, StartCol: 10, EndLine: 6, EndCol: 2, NumStmt: 1},
+		{StartLine: 8, StartCol: 19, EndLine: 9, EndCol: 16, NumStmt: 1, Count: 1},
+		{StartLine: 9, StartCol: 16, EndLine: 11, EndCol: 3, NumStmt: 1},
+		{StartLine: 11, StartCol: 3, EndLine: 16, EndCol: 2, NumStmt: 2, Count: 1},
+	}
+	profiles := []*cover.Profile{
+		{FileName: "example.com/p/bad.go", Blocks: blocks[:1]},
+		{FileName: "example.com/p/missing.go", Blocks: blocks[:1]},
+		{FileName: "example.com/p/p.go", Blocks: blocks},
+	}
+
+	warnings := applyDirectives(profiles, resolver)
+	if len(warnings) != 2 {
+		t.Errorf("expected 2 warnings, got %v", warnings)
+	}
+
+	expected := []cover.ProfileBlock{blocks[1], blocks[3]}
+	if actual := profiles[2].Blocks; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if len(profiles[0].Blocks) != 1 || len(profiles[1].Blocks) != 1 {
+		t.Error("expected profiles with warnings to be unchanged")
+	}
+}
+
+func TestApplyDirectivesGoTest(t *testing.T) {
+	// directives.out is the go test -coverprofile output of the module
+	resolver, err := NewResolver("testdata/directives")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	profiles, err := LoadProfiles("testdata/directives/directives.out")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if warnings := applyDirectives(profiles, resolver); len(warnings) != 0 {
+		t.Fatal("unexpected warnings", warnings)
+	}
+
+	expected := []cover.ProfileBlock{
+		{StartLine: 8, StartCol: 2, EndLine: 8, EndCol: 11, NumStmt: 1, Count: 1},
+		{StartLine: 20, StartCol: 2, EndLine: 20, EndCol: 12, NumStmt: 1, Count: 1},
+	}
+	if actual := profiles[0].Blocks; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,320 @@
+package covmerge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/denormal/go-gitignore"
+	"golang.org/x/tools/cover"
+)
+
+// IgnoreFileName is the name of the exclusion files found by discovery.
+const IgnoreFileName = ".coverignore"
+
+// ignoreFile is a gitignore style exclusion file.  When it sits next to a
+// go.mod it only applies to that module's files, and its patterns can also
+// be written relative to the module's path.
+type ignoreFile struct {
+	path   string
+	module string
+}
+
+// newIgnoreFile creates an ignoreFile, scoped to the module declared beside it if any.
+func newIgnoreFile(path string) ignoreFile {
+	f := ignoreFile{path: path}
+	if module, err := readModulePath(filepath.Join(filepath.Dir(path), "go.mod")); err == nil {
+		f.module = module
+	}
+	return f
+}
+
+// srcModule returns the path of the module containing src, or an empty
+// string when it is not within a module.
+func srcModule(src string) string {
+	root, err := findModuleRoot(src)
+	if err != nil {
+		return ""
+	}
+	module, err := readModulePath(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return module
+}
+
+// errNoneIncluded is returned when the include patterns match none of the files.
+var errNoneIncluded = errors.New("no files match the include patterns")
+
+// ignoreMatcher matches profile file names against a loaded ignoreFile.
+// A scoped matcher only matches the files of its module.
+type ignoreMatcher struct {
+	ignore gitignore.GitIgnore
+	module string
+	scoped bool
+}
+
+// match returns the last pattern matching fileName, trying the name relative
+// to the module first.  It returns nil if no pattern matches.
+func (m ignoreMatcher) match(fileName string) gitignore.Match {
+	inModule := m.module != "" && strings.HasPrefix(fileName, m.module+"/")
+	if inModule {
+		if match := m.ignore.Relative(strings.TrimPrefix(fileName, m.module+"/"), false); match != nil {
+			return match
+		}
+	} else if m.scoped {
+		return nil
+	}
+	return m.ignore.Relative(fileName, false)
+}
+
+// filterProfiles is used to filter profiles using gitignore style exclusion files.
+// The files are layered in order, the last file with a pattern matching a
+// profile decides if it is excluded, so later files can re-include with !pattern.
+// Files that are not found are skipped.
+func filterProfiles(profiles []*cover.Profile, ignoreFiles ...ignoreFile) ([]*cover.Profile, error) {
+	if len(profiles) == 0 {
+		return profiles, nil
+	}
+
+	matchers, err := loadIgnoreMatchers(ignoreFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matchers) == 0 {
+		return profiles, nil
+	}
+
+	filtered := make([]*cover.Profile, 0, len(profiles))
+	for _, p := range profiles {
+		if !lastMatch(matchers, p.FileName, false) {
+			filtered = append(filtered, p)
+		}
+	}
+
+	return filtered, nil
+}
+
+// loadIgnoreMatchers loads the ignore files that exist.
+func loadIgnoreMatchers(ignoreFiles []ignoreFile) ([]ignoreMatcher, error) {
+	matchers := make([]ignoreMatcher, 0, len(ignoreFiles))
+	for _, f := range ignoreFiles {
+		if _, err := os.Stat(f.path); err != nil {
+			continue // no ignore file.
+		}
+
+		ignore, err := gitignore.NewFromFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ignore file:%s", err)
+		}
+		matchers = append(matchers, ignoreMatcher{ignore: ignore, module: f.module, scoped: f.module != ""})
+	}
+	return matchers, nil
+}
+
+// lastMatch reports whether the last matcher with a pattern matching
+// fileName ignores it, or returns otherwise when none match.
+func lastMatch(matchers []ignoreMatcher, fileName string, otherwise bool) bool {
+	matched := otherwise
+	for _, m := range matchers {
+		if match := m.match(fileName); match != nil {
+			matched = match.Ignore()
+		}
+	}
+	return matched
+}
+
+// includeProfiles keeps only the profiles matched by the include patterns
+// and include files, which use the same gitignore syntax as the ignore files.
+// A trailing /... in a pattern matches everything below the path.  Like the
+// ignore files, the last source with a matching pattern decides, so !pattern
+// takes a file back out.  Patterns may also be written relative to module.
+// With no patterns every profile is kept, otherwise it is an error for the
+// patterns to drop every profile.
+func includeProfiles(profiles []*cover.Profile, patterns []string, includeFiles []string, module string) ([]*cover.Profile, error) {
+	if len(patterns) == 0 && len(includeFiles) == 0 {
+		return profiles, nil
+	}
+
+	matchers, err := loadIncludeMatchers(patterns, includeFiles, module)
+	if err != nil {
+		return nil, err
+	}
+
+	included := make([]*cover.Profile, 0, len(profiles))
+	for _, p := range profiles {
+		if lastMatch(matchers, p.FileName, false) {
+			included = append(included, p)
+		}
+	}
+
+	if len(included) == 0 && len(profiles) > 0 {
+		return nil, errNoneIncluded
+	}
+	return included, nil
+}
+
+// loadIncludeMatchers loads the include files followed by the include
+// patterns, scoped to module.
+func loadIncludeMatchers(patterns []string, includeFiles []string, module string) ([]ignoreMatcher, error) {
+	matchers := make([]ignoreMatcher, 0, len(includeFiles)+1)
+	for _, path := range includeFiles {
+		include, err := gitignore.NewFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read include file:%s", err)
+		}
+		matchers = append(matchers, ignoreMatcher{ignore: include, module: module})
+	}
+
+	if len(patterns) > 0 {
+		lines := make([]string, 0, len(patterns))
+		for _, pattern := range patterns {
+			if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+				pattern = prefix + "/**"
+			}
+			lines = append(lines, pattern)
+		}
+		include := gitignore.New(strings.NewReader(strings.Join(lines, "\n")), "", nil)
+		matchers = append(matchers, ignoreMatcher{ignore: include, module: module})
+	}
+	return matchers, nil
+}
+
+// fileFilter decides once for each file name whether its blocks are kept,
+// applying the include patterns, the ignore files and the generated file
+// check in turn.
+type fileFilter struct {
+	include   []ignoreMatcher
+	ignore    []ignoreMatcher
+	generated *Resolver
+	kept      map[string]bool
+	included  bool
+}
+
+// newFileFilter loads the include and ignore matchers, the include patterns
+// scoped to module.  Generated files are skipped when resolver is not nil.
+func newFileFilter(patterns, includeFiles, ignorePaths []string, module string, resolver *Resolver) (*fileFilter, error) {
+	f := &fileFilter{generated: resolver, kept: make(map[string]bool)}
+
+	if len(patterns) > 0 || len(includeFiles) > 0 {
+		include, err := loadIncludeMatchers(patterns, includeFiles, module)
+		if err != nil {
+			return nil, err
+		}
+		f.include = include
+	}
+
+	ignoreFiles := make([]ignoreFile, len(ignorePaths))
+	for i, path := range ignorePaths {
+		ignoreFiles[i] = newIgnoreFile(path)
+	}
+	ignore, err := loadIgnoreMatchers(ignoreFiles)
+	if err != nil {
+		return nil, err
+	}
+	f.ignore = ignore
+
+	return f, nil
+}
+
+// keep reports whether the blocks of fileName are kept.  A generated file
+// check that cannot be made keeps the file and returns a warning, only the
+// first time the file is seen.
+func (f *fileFilter) keep(fileName string) (bool, error) {
+	if kept, found := f.kept[fileName]; found {
+		return kept, nil
+	}
+
+	included := f.include == nil || lastMatch(f.include, fileName, false)
+	f.included = f.included || included
+	kept := included && !lastMatch(f.ignore, fileName, false)
+
+	var warning error
+	if kept && f.generated != nil {
+		var generated bool
+		generated, warning = isGeneratedFile(fileName, f.generated)
+		kept = !generated
+	}
+
+	f.kept[fileName] = kept
+	return kept, warning
+}
+
+// check returns an error when include patterns dropped every file seen.
+func (f *fileFilter) check() error {
+	if f.include != nil && len(f.kept) > 0 && !f.included {
+		return errNoneIncluded
+	}
+	return nil
+}
+
+// DiscoverIgnoreFiles finds the .coverignore files in dir and its parents,
+// outermost first, followed by those next to each go.mod below dir, which
+// only apply to their module's files.
+// Hidden, vendor, testdata and node_modules directories, and those starting
+// with an underscore, are not searched, nor are directories that cannot be
+// read.
+func DiscoverIgnoreFiles(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var parents []string
+	for current := dir; ; current = filepath.Dir(current) {
+		if path := filepath.Join(current, IgnoreFileName); isFile(path) {
+			parents = append([]string{path}, parents...)
+		}
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	var modules []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// an unreadable directory cannot hold an ignore file to apply
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" || filepath.Dir(path) == dir {
+			return nil
+		}
+		if ignore := filepath.Join(filepath.Dir(path), IgnoreFileName); isFile(ignore) {
+			modules = append(modules, ignore)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(parents, modules...), nil
+}
+
+// skipDir reports whether discovery skips a directory, which like the go
+// command ignores hidden, underscore, vendor and testdata directories.
+func skipDir(name string) bool {
+	switch name {
+	case "vendor", "testdata", "node_modules":
+		return true
+	}
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
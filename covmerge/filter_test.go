@@ -0,0 +1,328 @@
+package covmerge
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestFilterNoFile(t *testing.T) {
+	profiles, err := LoadProfiles("testdata/cover_1.out")
+	if err != nil {
+		t.Fatal("fatal profile read", err)
+	}
+
+	if len(profiles) != 1 {
+		t.Fatal("profile len not 1", len(profiles))
+	}
+
+	ret, err := filterProfiles(profiles, ignoreFile{path: "nofile"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(ret) != len(profiles) {
+		t.Fatal("len wrong", len(profiles), len(ret))
+	}
+}
+
+func TestFilterIncludeAll(t *testing.T) {
+	profiles, err := LoadProfiles("testdata/cover_1.out")
+	if err != nil {
+		t.Fatal("fatal profile read", err)
+	}
+
+	if len(profiles) != 1 {
+		t.Fatal("profile len not 1", len(profiles))
+	}
+
+	ret, err := filterProfiles(profiles, ignoreFile{path: "testdata/filter"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(ret) != len(profiles) {
+		t.Fatal("len wrong", len(profiles), len(ret))
+	}
+}
+
+func TestFilterIncludeNoAlt(t *testing.T) {
+	profiles, err := LoadProfiles("testdata/cover_multi.out")
+	if err != nil {
+		t.Fatal("fatal profile read", err)
+	}
+
+	if len(profiles) != 3 {
+		t.Fatal("profile len not 3", len(profiles))
+	}
+
+	ret, err := filterProfiles(profiles, ignoreFile{path: "testdata/filter"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(ret) != 1 {
+		t.Fatal("len wrong alt still in?", len(profiles), len(ret))
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fileNames(profiles []*cover.Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		names = append(names, p.FileName)
+	}
+	return names
+}
+
+func TestFilterLayered(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "first"), "github.com/repo/alternate/*\n")
+	writeFile(t, filepath.Join(dir, "second"), "!github.com/repo/alternate/keep.go\n")
+
+	profiles := []*cover.Profile{
+		{FileName: "github.com/repo/alternate/drop.go"},
+		{FileName: "github.com/repo/alternate/keep.go"},
+		{FileName: "github.com/repo/main.go"},
+	}
+
+	ret, err := filterProfiles(profiles, ignoreFile{path: filepath.Join(dir, "first")}, ignoreFile{path: filepath.Join(dir, "second")})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"github.com/repo/alternate/keep.go", "github.com/repo/main.go"}
+	if actual := fileNames(ret); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFilterModuleRelative(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module github.com/repo/svc\n")
+	writeFile(t, filepath.Join(dir, IgnoreFileName), "internal/mocks/*\n")
+
+	profiles := []*cover.Profile{
+		{FileName: "github.com/repo/svc/internal/mocks/db.go"},
+		{FileName: "github.com/repo/svc/internal/db.go"},
+		{FileName: "github.com/repo/other/internal/mocks/db.go"},
+	}
+
+	ret, err := filterProfiles(profiles, newIgnoreFile(filepath.Join(dir, IgnoreFileName)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"github.com/repo/svc/internal/db.go", "github.com/repo/other/internal/mocks/db.go"}
+	if actual := fileNames(ret); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestDiscoverIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, IgnoreFileName), "")
+	writeFile(t, filepath.Join(root, "work", IgnoreFileName), "")
+	writeFile(t, filepath.Join(root, "work", "svc", "go.mod"), "module example.com/svc\n")
+	writeFile(t, filepath.Join(root, "work", "svc", IgnoreFileName), "")
+	writeFile(t, filepath.Join(root, "work", "lib", "go.mod"), "module example.com/lib\n")
+	writeFile(t, filepath.Join(root, "work", "vendor", "x", "go.mod"), "module example.com/x\n")
+	writeFile(t, filepath.Join(root, "work", "vendor", "x", IgnoreFileName), "")
+	writeFile(t, filepath.Join(root, "work", "node_modules", "y", "go.mod"), "module example.com/y\n")
+	writeFile(t, filepath.Join(root, "work", "node_modules", "y", IgnoreFileName), "")
+	writeFile(t, filepath.Join(root, "work", "_build", "z", "go.mod"), "module example.com/z\n")
+	writeFile(t, filepath.Join(root, "work", "_build", "z", IgnoreFileName), "")
+
+	files, err := DiscoverIgnoreFiles(filepath.Join(root, "work"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{
+		filepath.Join(root, IgnoreFileName),
+		filepath.Join(root, "work", IgnoreFileName),
+		filepath.Join(root, "work", "svc", IgnoreFileName),
+	}
+
+	// parent directories of the temp dir may hold their own ignore files
+	if len(files) < len(expected) {
+		t.Fatal("len wrong", files)
+	}
+	if actual := files[len(files)-len(expected):]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestDiscoverIgnoreFilesModules(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "go.mod"), "module example.com/a\n")
+	writeFile(t, filepath.Join(root, "a", IgnoreFileName), "*.pb.go\nutil.go\n")
+	writeFile(t, filepath.Join(root, "b", "go.mod"), "module example.com/b\n")
+
+	paths, err := DiscoverIgnoreFiles(root)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	ignoreFiles := make([]ignoreFile, len(paths))
+	for i, path := range paths {
+		ignoreFiles[i] = newIgnoreFile(path)
+	}
+
+	profiles := []*cover.Profile{
+		{FileName: "example.com/a/main.go"},
+		{FileName: "example.com/a/util.go"},
+		{FileName: "example.com/a/x.pb.go"},
+		{FileName: "example.com/b/util.go"},
+		{FileName: "example.com/b/y.pb.go"},
+	}
+
+	ret, err := filterProfiles(profiles, ignoreFiles...)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// the ignore file of module a does not apply to module b
+	expected := []string{"example.com/a/main.go", "example.com/b/util.go", "example.com/b/y.pb.go"}
+	if actual := fileNames(ret); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestDiscoverIgnoreFilesUnreadable(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "svc", "go.mod"), "module example.com/svc\n")
+	writeFile(t, filepath.Join(root, "svc", IgnoreFileName), "")
+	locked := filepath.Join(root, "locked")
+	writeFile(t, filepath.Join(locked, "go.mod"), "module example.com/locked\n")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0o755)
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("permissions are not enforced")
+	}
+
+	files, err := DiscoverIgnoreFiles(root)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if last := files[len(files)-1]; last != filepath.Join(root, "svc", IgnoreFileName) {
+		t.Errorf("expected the svc ignore file, got %v", files)
+	}
+}
+
+func includeTestProfiles() []*cover.Profile {
+	return []*cover.Profile{
+		{FileName: "github.com/repo/internal/payments/card.go"},
+		{FileName: "github.com/repo/internal/payments/mocks/card.go"},
+		{FileName: "github.com/repo/internal/users/user.go"},
+		{FileName: "github.com/repo/main.go"},
+	}
+}
+
+func TestIncludeProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "include"), "**/users/**\n")
+
+	testCases := []struct {
+		name     string
+		patterns []string
+		files    []string
+		expected []string
+	}{
+		{
+			name:     "none",
+			expected: fileNames(includeTestProfiles()),
+		},
+		{
+			name:     "go style",
+			patterns: []string{"github.com/repo/internal/payments/..."},
+			expected: []string{"github.com/repo/internal/payments/card.go", "github.com/repo/internal/payments/mocks/card.go"},
+		},
+		{
+			name:     "glob",
+			patterns: []string{"**/payments/**", "!**/mocks/**"},
+			expected: []string{"github.com/repo/internal/payments/card.go"},
+		},
+		{
+			name:     "file and pattern",
+			patterns: []string{"github.com/repo/main.go"},
+			files:    []string{filepath.Join(dir, "include")},
+			expected: []string{"github.com/repo/internal/users/user.go", "github.com/repo/main.go"},
+		},
+		{
+			name:     "module relative",
+			patterns: []string{"internal/users/...", "main.go"},
+			expected: []string{"github.com/repo/internal/users/user.go", "github.com/repo/main.go"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ret, err := includeProfiles(includeTestProfiles(), tc.patterns, tc.files, "github.com/repo")
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if actual := fileNames(ret); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIncludeProfilesMissingFile(t *testing.T) {
+	if _, err := includeProfiles(includeTestProfiles(), nil, []string{"testdata/nofile"}, ""); err == nil {
+		t.Error("expected missing include file error")
+	}
+}
+
+func TestIncludeProfilesNoMatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		module   string
+	}{
+		{"other module", []string{"github.com/other/..."}, "github.com/repo"},
+		{"relative without module", []string{"internal/..."}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := includeProfiles(includeTestProfiles(), tc.patterns, nil, tc.module); err != errNoneIncluded {
+				t.Errorf("expected %v, got %v", errNoneIncluded, err)
+			}
+		})
+	}
+
+	if ret, err := includeProfiles(nil, []string{"github.com/other/..."}, nil, ""); err != nil || len(ret) != 0 {
+		t.Errorf("expected no profiles, got %v %v", ret, err)
+	}
+}
+
+func TestIncludeThenExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "ignore"), "**/mocks/**\n")
+
+	ret, err := includeProfiles(includeTestProfiles(), []string{"github.com/repo/internal/..."}, nil, "")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	ret, err = filterProfiles(ret, ignoreFile{path: filepath.Join(dir, "ignore")})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"github.com/repo/internal/payments/card.go", "github.com/repo/internal/users/user.go"}
+	if actual := fileNames(ret); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
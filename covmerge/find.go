@@ -0,0 +1,230 @@
+package covmerge
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FindInputs expands input arguments into the inputs to add.  Arguments
+// holding glob metacharacters are matched against the file system, where a
+// ** path element matches any number of directories.  Directories, other
+// than binary coverage directories, are searched recursively for files
+// whose names match the glob pattern and whose content is a go cover
+// profile or LCOV tracefile, and for binary coverage directories.  Files
+// matched by a glob are also skipped unless they hold profile data.  Hidden
+// directories are not searched.  Other arguments are kept as they are.
+// The inputs are returned in argument order without duplicates.
+func FindInputs(args []string, pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("bad file name pattern %q: %w", pattern, err)
+	}
+
+	var inputs []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		found, err := findInputs(arg, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, input := range found {
+			if key := filepath.Clean(input); !seen[key] {
+				seen[key] = true
+				inputs = append(inputs, input)
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// findInputs expands a single input argument.
+func findInputs(arg, pattern string) ([]string, error) {
+	if !hasMeta(arg) {
+		if !isSearchDir(arg) {
+			return []string{arg}, nil
+		}
+		inputs, err := searchDir(arg, pattern)
+		if err == nil && len(inputs) == 0 {
+			err = fmt.Errorf("%s: no profiles found", arg)
+		}
+		return inputs, err
+	}
+
+	matches, err := glob(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []string
+	for _, match := range matches {
+		switch {
+		case isSearchDir(match):
+			found, err := searchDir(match, pattern)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, found...)
+		case isCoverDir(match) || isProfileFile(match):
+			inputs = append(inputs, match)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no profiles match %s", arg)
+	}
+	return inputs, nil
+}
+
+// isSearchDir reports whether path is a directory to search for profiles,
+// rather than a binary coverage directory.
+func isSearchDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir() && !isCoverDir(path)
+}
+
+// searchDir finds the profile files whose names match pattern and the
+// binary coverage directories in dir and its subdirectories.
+func searchDir(dir, pattern string) ([]string, error) {
+	var inputs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if isCoverDir(path) {
+				inputs = append(inputs, path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matched, _ := filepath.Match(pattern, d.Name()); matched && d.Type().IsRegular() && isProfileFile(path) {
+			inputs = append(inputs, path)
+		}
+		return nil
+	})
+	return inputs, err
+}
+
+// isProfileFile reports whether file starts like a go cover profile or an
+// LCOV tracefile.
+func isProfileFile(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if isLCOV(r) {
+		return true
+	}
+	peek, _ := r.Peek(len("mode: "))
+	return bytes.Equal(peek, []byte("mode: "))
+}
+
+// hasMeta reports whether path holds glob metacharacters.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// glob returns the paths matching pattern in lexical order.  Unlike
+// filepath.Glob a ** element matches any number of directories, which are
+// searched skipping hidden directories.
+func glob(pattern string) ([]string, error) {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, elem := range elems {
+		if _, err := filepath.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+
+	// the directory to search is the leading elements without metacharacters
+	n := 0
+	for n < len(elems) && !hasMeta(elems[n]) {
+		n++
+	}
+	rest := elems[n:]
+	if !containsElem(rest, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	root := filepath.FromSlash(strings.Join(elems[:n], "/"))
+	switch {
+	case n == 1 && elems[0] == "":
+		root = string(filepath.Separator)
+	case n == 0:
+		root = "."
+	}
+	return globDir(root, rest)
+}
+
+// globDir returns the paths below root whose path relative to root matches
+// the pattern elements.
+func globDir(root string, pattern []string) ([]string, error) {
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && d.IsDir() && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		var elems []string
+		if rel != "." {
+			elems = strings.Split(filepath.ToSlash(rel), "/")
+		}
+		if matchElems(pattern, elems) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	sort.Strings(matches)
+	return matches, err
+}
+
+// matchElems matches path elements against pattern elements, a ** pattern
+// element matching zero or more path elements.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern[0], elems[0]); !matched {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+func containsElem(elems []string, elem string) bool {
+	for _, e := range elems {
+		if e == elem {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package covmerge
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeInputs creates a tree of profile and other files in a temporary
+// directory, returning the directory.
+func writeInputs(t *testing.T) string {
+	dir := t.TempDir()
+	profile := "mode: set\nexample.com/a.go:1.1,2.1 1 1\n"
+	writeFile(t, filepath.Join(dir, "a.out"), profile)
+	writeFile(t, filepath.Join(dir, "b.txt"), "not a profile\n")
+	writeFile(t, filepath.Join(dir, "cov", "covmeta.1"), string(covMetaMagic))
+	writeFile(t, filepath.Join(dir, "sub", "c.out"), profile)
+	writeFile(t, filepath.Join(dir, "sub", "d.info"), "\nSF:example.com/a.go\nDA:1,1\nend_of_record\n")
+	writeFile(t, filepath.Join(dir, "sub", "e.out"), "package sub\n")
+	writeFile(t, filepath.Join(dir, ".hidden", "f.out"), profile)
+	return dir
+}
+
+func TestFindInputs(t *testing.T) {
+	dir := writeInputs(t)
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	testCases := []struct {
+		name     string
+		args     []string
+		pattern  string
+		expected []string
+	}{
+		{"dir", []string{dir}, "*", []string{in("a.out"), in("cov"), in("sub/c.out"), in("sub/d.info")}},
+		{"dir pattern", []string{dir}, "*.out", []string{in("a.out"), in("cov"), in("sub/c.out")}},
+		{"globstar", []string{in("**/*.out")}, "*", []string{in("a.out"), in("sub/c.out")}},
+		{"glob", []string{in("sub/*")}, "*", []string{in("sub/c.out"), in("sub/d.info")}},
+		{"glob dir", []string{in("s*")}, "*.info", []string{in("sub/d.info")}},
+		{"cover dir", []string{in("cov")}, "*", []string{in("cov")}},
+		{"hidden root", []string{in(".hidden")}, "*", []string{in(".hidden/f.out")}},
+		{"files kept", []string{in("b.txt"), in("missing.out")}, "*", []string{in("b.txt"), in("missing.out")}},
+		{"duplicates", []string{in("a.out"), in("*.out"), dir}, "*.out", []string{in("a.out"), in("cov"), in("sub/c.out")}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputs, err := FindInputs(tc.args, tc.pattern)
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if !reflect.DeepEqual(inputs, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, inputs)
+			}
+		})
+	}
+}
+
+func TestFindInputsErrors(t *testing.T) {
+	dir := writeInputs(t)
+
+	testCases := []struct {
+		name    string
+		args    []string
+		pattern string
+	}{
+		{"no match", []string{filepath.Join(dir, "*.none")}, "*"},
+		{"no profiles", []string{filepath.Join(dir, "*.txt")}, "*"},
+		{"empty dir", []string{t.TempDir()}, "*"},
+		{"dir pattern", []string{filepath.Join(dir, "sub")}, "*.none"},
+		{"bad pattern", []string{dir}, "["},
+		{"bad glob", []string{filepath.Join(dir, "**", "[")}, "*"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if inputs, err := FindInputs(tc.args, tc.pattern); err == nil {
+				t.Errorf("expected error, got %v", inputs)
+			}
+		})
+	}
+}
+
+func TestMatchElems(t *testing.T) {
+	testCases := []struct {
+		pattern  []string
+		elems    []string
+		expected bool
+	}{
+		{[]string{"**"}, nil, true},
+		{[]string{"**", "*.out"}, []string{"a.out"}, true},
+		{[]string{"**", "*.out"}, []string{"x", "y", "a.out"}, true},
+		{[]string{"**", "*.out"}, []string{"a.out", "x"}, false},
+		{[]string{"x", "**", "y", "*.out"}, []string{"x", "y", "a.out"}, true},
+		{[]string{"x", "**", "y", "*.out"}, []string{"x", "z", "a.out"}, false},
+		{[]string{"*.out"}, nil, false},
+	}
+
+	for _, tc := range testCases {
+		if actual := matchElems(tc.pattern, tc.elems); actual != tc.expected {
+			t.Errorf("%v %v: expected %v, got %v", tc.pattern, tc.elems, tc.expected, actual)
+		}
+	}
+}
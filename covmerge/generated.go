@@ -0,0 +1,61 @@
+package covmerge
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// generatedRe matches the standard comment marking generated Go source, see https://go.dev/s/generatedcode.
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the Go source file has a generated code
+// comment before its package clause.
+func isGenerated(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if generatedRe.MatchString(line) {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// skipGenerated drops the profiles of generated source files.  Files that
+// cannot be inspected are kept and reported in the returned warnings.
+func skipGenerated(profiles []*cover.Profile, resolver *Resolver) ([]*cover.Profile, []error) {
+	var warnings []error
+	kept := make([]*cover.Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		generated, err := isGeneratedFile(profile.FileName, resolver)
+		if err != nil {
+			warnings = append(warnings, err)
+		}
+		if !generated {
+			kept = append(kept, profile)
+		}
+	}
+	return kept, warnings
+}
+
+// isGeneratedFile reports whether the source of a profile file name is generated.
+func isGeneratedFile(fileName string, resolver *Resolver) (bool, error) {
+	file, err := resolver.Resolve(fileName)
+	if err != nil {
+		return false, err
+	}
+	return isGenerated(file)
+}
@@ -0,0 +1,65 @@
+package covmerge
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestIsGenerated(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "late.go"), "package p\n\n// Code generated by x. DO NOT EDIT.\n")
+	writeFile(t, filepath.Join(dir, "crlf.go"), "// Code generated by x. DO NOT EDIT.\r\npackage p\r\n")
+
+	testCases := []struct {
+		file     string
+		expected bool
+	}{
+		{"testdata/module/gen.go", true},
+		{"testdata/module/sample.go", false},
+		{filepath.Join(dir, "late.go"), false},
+		{filepath.Join(dir, "crlf.go"), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			actual, err := isGenerated(tc.file)
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+
+	if _, err := isGenerated("testdata/module/missing.go"); err == nil {
+		t.Error("expected missing file error")
+	}
+}
+
+func TestSkipGenerated(t *testing.T) {
+	resolver, err := NewResolver("testdata/module")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	profiles := []*cover.Profile{
+		{FileName: "example.com/sample/gen.go"},
+		{FileName: "example.com/sample/sample.go"},
+		{FileName: "example.com/sample/missing.go"},
+	}
+
+	kept, warnings := skipGenerated(profiles, resolver)
+
+	expected := []string{"example.com/sample/sample.go", "example.com/sample/missing.go"}
+	if actual := fileNames(kept); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if len(warnings) != 1 || warnings[0].Error() != "example.com/sample/missing.go: source not found in module example.com/sample" {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+}
@@ -0,0 +1,43 @@
+package covmerge
+
+import (
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// LineHit is the execution count of a source line.
+type LineHit struct {
+	Line, Count int
+}
+
+// LineHits derives the execution count of each line from a profile's blocks,
+// returned in line order.  Blocks without statements are skipped and a line
+// touched by several blocks takes the highest count.
+func LineHits(profile *cover.Profile) []LineHit {
+	counts := make(map[int]int)
+	for _, block := range profile.Blocks {
+		if block.NumStmt == 0 {
+			continue
+		}
+
+		// a block ending at the start of a line does not cover that line
+		endLine := block.EndLine
+		if block.EndCol <= 1 && endLine > block.StartLine {
+			endLine--
+		}
+
+		for line := block.StartLine; line <= endLine; line++ {
+			if count, found := counts[line]; !found || block.Count > count {
+				counts[line] = block.Count
+			}
+		}
+	}
+
+	hits := make([]LineHit, 0, len(counts))
+	for line, count := range counts {
+		hits = append(hits, LineHit{Line: line, Count: count})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Line < hits[j].Line })
+	return hits
+}
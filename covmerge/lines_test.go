@@ -0,0 +1,60 @@
+package covmerge
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestLineHits(t *testing.T) {
+	testCases := []struct {
+		name     string
+		blocks   []cover.ProfileBlock
+		expected []LineHit
+	}{
+		{
+			name:     "empty",
+			expected: []LineHit{},
+		},
+		{
+			name: "single",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 3},
+			},
+			expected: []LineHit{{17, 3}, {18, 3}, {19, 3}},
+		},
+		{
+			name: "shared line takes highest",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 22, StartCol: 10, EndLine: 25, EndCol: 35, NumStmt: 3, Count: 0},
+				{StartLine: 25, StartCol: 35, EndLine: 26, EndCol: 18, NumStmt: 1, Count: 1},
+			},
+			expected: []LineHit{{22, 0}, {23, 0}, {24, 0}, {25, 1}, {26, 1}},
+		},
+		{
+			name: "no statements",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 10, EndLine: 2, EndCol: 2, NumStmt: 0, Count: 0},
+				{StartLine: 3, StartCol: 2, EndLine: 3, EndCol: 12, NumStmt: 1, Count: 0},
+			},
+			expected: []LineHit{{3, 0}},
+		},
+		{
+			name: "ends at line start",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 9, StartCol: 3, EndLine: 10, EndCol: 1, NumStmt: 1, Count: 1},
+			},
+			expected: []LineHit{{9, 1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := LineHits(&cover.Profile{Blocks: tc.blocks})
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
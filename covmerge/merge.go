@@ -0,0 +1,233 @@
+package covmerge
+
+import (
+	"os"
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// Cover profile modes.
+const (
+	ModeSet    = "set"
+	ModeCount  = "count"
+	ModeAtomic = "atomic"
+)
+
+// LoadProfiles reads a cover profile, LCOV tracefile or binary coverage directory.
+func LoadProfiles(path string) ([]*cover.Profile, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return loadCoverDir(path)
+	}
+	return parseProfileFile(path)
+}
+
+type orderedBlocks []cover.ProfileBlock
+
+func (b orderedBlocks) Len() int           { return len(b) }
+func (b orderedBlocks) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b orderedBlocks) Less(i, j int) bool { return blockLess(&b[i], &b[j]) }
+
+// blockLess orders blocks by their start and then their end position.
+func blockLess(b1, b2 *cover.ProfileBlock) bool {
+	if b1.StartLine != b2.StartLine {
+		return b1.StartLine < b2.StartLine
+	}
+	if b1.StartCol != b2.StartCol {
+		return b1.StartCol < b2.StartCol
+	}
+	if b1.EndLine != b2.EndLine {
+		return b1.EndLine < b2.EndLine
+	}
+	return b1.EndCol < b2.EndCol
+}
+
+func maxEndLine(b1, b2 *cover.ProfileBlock) (int, int) {
+	if b1.EndLine > b2.EndLine {
+		return b1.EndLine, b1.EndCol
+	}
+	if b2.EndLine > b1.EndLine {
+		return b2.EndLine, b2.EndCol
+	}
+	if b1.EndCol > b2.EndCol {
+		return b1.EndLine, b1.EndCol
+	}
+	return b2.EndLine, b2.EndCol
+}
+
+func combine(profiles []*cover.Profile) map[string]*cover.Profile {
+	fileMap := make(map[string]*cover.Profile)
+
+	// combine all blocks by file name
+	for _, profile := range profiles {
+		if p, found := fileMap[profile.FileName]; found {
+			p.Blocks = append(p.Blocks, profile.Blocks...)
+		} else {
+			fileMap[profile.FileName] = profile
+		}
+	}
+
+	return fileMap
+}
+
+type byFileName []*cover.Profile
+
+func (p byFileName) Len() int           { return len(p) }
+func (p byFileName) Less(i, j int) bool { return p[i].FileName < p[j].FileName }
+func (p byFileName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func overlaps(b1, b2 *cover.ProfileBlock) bool {
+	// return true if b2 overlaps b1
+	if b1.EndLine < b2.StartLine {
+		return false
+	}
+	if b1.EndLine > b2.StartLine {
+		return true
+	}
+	return b1.EndCol >= b2.StartCol
+}
+
+// sameRange reports whether b1 and b2 cover exactly the same source range.
+func sameRange(b1, b2 *cover.ProfileBlock) bool {
+	return b1.StartLine == b2.StartLine && b1.StartCol == b2.StartCol &&
+		b1.EndLine == b2.EndLine && b1.EndCol == b2.EndCol
+}
+
+// mergeCount combines the counts of two identical blocks.  In set mode the
+// blocks are unioned, in count and atomic mode the executions are summed.
+func mergeCount(mode string, a, b int) int {
+	if mode == ModeSet {
+		return max(a, b)
+	}
+	return a + b
+}
+
+// collapseIdentical merges runs of identical blocks in a sorted block list.
+func collapseIdentical(mode string, blocks []cover.ProfileBlock) []cover.ProfileBlock {
+	collapsed := make([]cover.ProfileBlock, 0, len(blocks))
+	for _, block := range blocks {
+		if n := len(collapsed); n > 0 && sameRange(&collapsed[n-1], &block) {
+			last := &collapsed[n-1]
+			last.NumStmt = max(last.NumStmt, block.NumStmt)
+			last.Count = mergeCount(mode, last.Count, block.Count)
+			continue
+		}
+		collapsed = append(collapsed, block)
+	}
+	return collapsed
+}
+
+// Block merge strategies.
+const (
+	// StrategyUnion unions overlapping blocks into a single block.
+	StrategyUnion = "union"
+	// StrategySplit splits overlapping blocks at their boundaries.
+	StrategySplit = "split"
+	// StrategySource maps blocks onto the blocks of the current source.
+	// Files whose source cannot be found or parsed are reported through
+	// Options.Warn and merged with StrategyUnion instead.
+	StrategySource = "source"
+)
+
+// blockMerger merges the sorted blocks of a single file's profile.
+type blockMerger func(profile *cover.Profile) ([]cover.ProfileBlock, error)
+
+// mergeWith adapts a block merging algorithm to a blockMerger.
+func mergeWith(merge func(mode string, blocks []cover.ProfileBlock) []cover.ProfileBlock) blockMerger {
+	return func(profile *cover.Profile) ([]cover.ProfileBlock, error) {
+		return merge(profile.Mode, profile.Blocks), nil
+	}
+}
+
+// unionBlocks merges sorted blocks by unioning overlapping ranges into a single block.
+func unionBlocks(mode string, blocks []cover.ProfileBlock) []cover.ProfileBlock {
+	// identical blocks first, so count mode can add up the executions
+	blocks = collapseIdentical(mode, blocks)
+
+	deduped := make([]cover.ProfileBlock, 0, len(blocks))
+	var current *cover.ProfileBlock
+	for _, blockIterator := range blocks {
+		block := blockIterator
+		if current == nil {
+			current = &block
+			continue
+		}
+		if overlaps(current, &block) {
+			// merge blocks as overlapping
+			current.EndLine, current.EndCol = maxEndLine(current, &block)
+			current.NumStmt = max(current.NumStmt, block.NumStmt)
+			current.Count = max(current.Count, block.Count)
+		} else {
+			deduped = append(deduped, *current)
+			current = &block
+		}
+	}
+	if current != nil {
+		deduped = append(deduped, *current)
+	}
+	return deduped
+}
+
+// DeDuplicate combines the profiles by file name and unions their
+// overlapping blocks, returning the profiles sorted by file name.  The
+// profiles passed in are modified.
+func DeDuplicate(profiles []*cover.Profile) []*cover.Profile {
+	// union merging never fails
+	merged, _ := mergeProfiles(profiles, mergeWith(unionBlocks), 0)
+	return merged
+}
+
+// mergeProfiles combines the profiles by file and merges each file's blocks
+// using merger, up to workers files at once.
+func mergeProfiles(profiles []*cover.Profile, merger blockMerger, workers int) ([]*cover.Profile, error) {
+	combined := combine(profiles)
+
+	result := make([]*cover.Profile, 0, len(combined))
+	for _, profile := range combined {
+		result = append(result, profile)
+	}
+	sort.Sort(byFileName(result))
+
+	// dedup blocks, each file independently of the others
+	err := forEach(len(result), workers, func(i int) error {
+		return mergeFile(result[i], merger)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeFile sorts and merges the blocks of a single file's combined profile.
+func mergeFile(profile *cover.Profile, merger blockMerger) error {
+	sort.Sort(orderedBlocks(profile.Blocks))
+	blocks, err := merger(profile)
+	if err != nil {
+		return err
+	}
+	endLines(blocks)
+	profile.Blocks = blocks
+	return nil
+}
+
+// endLines moves the positions at the end of an LCOV line to the start of
+// the next line, the way go cover profiles end a block with its line, so
+// the end column never reaches the output.
+func endLines(blocks []cover.ProfileBlock) {
+	for i := range blocks {
+		b := &blocks[i]
+		if b.StartCol == lcovEndCol {
+			b.StartLine, b.StartCol = b.StartLine+1, 1
+		}
+		if b.EndCol == lcovEndCol {
+			b.EndLine, b.EndCol = b.EndLine+1, 1
+		}
+	}
+}
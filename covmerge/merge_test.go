@@ -0,0 +1,445 @@
+package covmerge
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestMax(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a, b     int
+		expected int
+	}{
+		{"a", 1, 0, 1},
+		{"b", 0, 1, 1},
+		{"equal", 1, 1, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := max(tc.a, tc.b)
+			if actual != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestByFileName(t *testing.T) {
+	// test byFileName sorting
+
+	testCases := []struct {
+		name     string
+		order    []*cover.Profile
+		expected []*cover.Profile
+	}{
+		{"empty", []*cover.Profile{}, []*cover.Profile{}},
+		{"one", []*cover.Profile{{FileName: "a"}}, []*cover.Profile{{FileName: "a"}}},
+		{"two", []*cover.Profile{{FileName: "b"}, {FileName: "a"}}, []*cover.Profile{{FileName: "a"}, {FileName: "b"}}},
+		{"three", []*cover.Profile{{FileName: "b"}, {FileName: "c"}, {FileName: "a"}}, []*cover.Profile{{FileName: "a"}, {FileName: "b"}, {FileName: "c"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sort.Sort(byFileName(tc.order))
+			if !reflect.DeepEqual(tc.order, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, tc.order)
+			}
+		})
+	}
+}
+
+func TestCombine(t *testing.T) {
+	// test function combine
+	testCases := []struct {
+		name     string
+		order    []*cover.Profile
+		expected map[string]*cover.Profile
+	}{
+		{"empty", []*cover.Profile{}, map[string]*cover.Profile{}},
+		{"one", []*cover.Profile{{FileName: "a"}}, map[string]*cover.Profile{"a": {FileName: "a"}}},
+		{"two", []*cover.Profile{{FileName: "b"}, {FileName: "a"}}, map[string]*cover.Profile{"a": {FileName: "a"}, "b": {FileName: "b"}}},
+		{"three", []*cover.Profile{{FileName: "b"}, {FileName: "c"}, {FileName: "a"}}, map[string]*cover.Profile{"a": {FileName: "a"}, "b": {FileName: "b"}, "c": {FileName: "c"}}},
+		{
+			"blocks",
+			[]*cover.Profile{
+				{FileName: "b", Blocks: []cover.ProfileBlock{{StartLine: 1}}},
+				{FileName: "b", Blocks: []cover.ProfileBlock{{StartLine: 2}}},
+				{FileName: "a"},
+			},
+			map[string]*cover.Profile{
+				"a": {FileName: "a"},
+				"b": {FileName: "b", Blocks: []cover.ProfileBlock{{StartLine: 1}, {StartLine: 2}}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := combine(tc.order)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMaxEndLine(t *testing.T) {
+	// test function maxEndLine
+	testCases := []struct {
+		name      string
+		a, b      cover.ProfileBlock
+		line, col int
+	}{
+		{
+			name: "equal",
+			a:    cover.ProfileBlock{EndLine: 1, EndCol: 1},
+			b:    cover.ProfileBlock{EndLine: 1, EndCol: 1},
+			line: 1,
+			col:  1,
+		},
+		{
+			name: "disjoint",
+			a:    cover.ProfileBlock{EndLine: 2, EndCol: 25},
+			b:    cover.ProfileBlock{EndLine: 1, EndCol: 1},
+			line: 2,
+			col:  25,
+		},
+		{
+			name: "overlapping",
+			a:    cover.ProfileBlock{EndLine: 1, EndCol: 25},
+			b:    cover.ProfileBlock{EndLine: 7, EndCol: 1},
+			line: 7,
+			col:  1,
+		},
+		{
+			name: "same line",
+			a:    cover.ProfileBlock{EndLine: 7, EndCol: 25},
+			b:    cover.ProfileBlock{EndLine: 7, EndCol: 1},
+			line: 7,
+			col:  25,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			line, col := maxEndLine(&tc.a, &tc.b)
+			if line != tc.line || col != tc.col {
+				t.Errorf("expected %d:%d, got %d:%d", tc.line, tc.col, line, col)
+			}
+		})
+	}
+}
+
+func TestOrderedBlocks(t *testing.T) {
+	// test sorting of orderedBlocks
+	testCases := []struct {
+		name     string
+		blocks   []cover.ProfileBlock
+		expected []cover.ProfileBlock
+	}{
+		{
+			name: "basic",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+		},
+		{
+			name: "overlapping",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 16, StartCol: 76, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 16, StartCol: 76, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+		},
+		{
+			name: "same start",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+		},
+		{
+			name: "same start col",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+		},
+		{
+			name: "same end line",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
+			},
+		},
+		{
+			name: "same end line and col",
+			blocks: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
+				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := orderedBlocks(tc.blocks)
+			sort.Sort(actual)
+			if len(actual) != len(tc.expected) {
+				t.Fatal("len wrong", tc.expected, actual)
+			}
+			for i, v := range tc.expected {
+				if v != actual[i] {
+					t.Error("order fail", i, v, actual[i])
+				}
+			}
+		})
+	}
+}
+
+func sp(s string) *string {
+	return &s
+}
+
+func ps(sp *string) string {
+	if sp == nil {
+		return ""
+	}
+	return *sp
+}
+
+func TestLoadProfiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		expected []*cover.Profile
+		err      *string
+	}{
+		{
+			name: "missing",
+			file: "testdata/notfound.out",
+			err:  sp("open testdata/notfound.out: no such file or directory"),
+		},
+		{
+			name:     "one",
+			file:     "testdata/cover_1.out",
+			expected: newProfileOne(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := LoadProfiles(tc.file)
+			if err != nil {
+				if tc.err == nil || err.Error() != *tc.err {
+					t.Fatalf("unexpected:\n%s\n%s\n", ps(tc.err), err)
+				}
+			} else if tc.err != nil {
+				t.Fatal("expected", err)
+			}
+			if len(actual) != len(tc.expected) {
+				t.Errorf("len wrong %v %+v\n", tc.expected, actual)
+			}
+
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("wrong %v %+v\n", tc.expected, actual[0])
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	// test overlaps
+	testCases := []struct {
+		name     string
+		b1       cover.ProfileBlock
+		b2       cover.ProfileBlock
+		expected bool
+	}{
+		{
+			name:     "none",
+			expected: true,
+		},
+		{
+			name:     "same",
+			b1:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1},
+			b2:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1},
+			expected: true,
+		},
+		{
+			name:     "adjacent",
+			b1:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1},
+			b2:       cover.ProfileBlock{StartLine: 1, StartCol: 2, EndLine: 1, EndCol: 2},
+			expected: false,
+		},
+		{
+			name:     "overlap",
+			b1:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 2},
+			b2:       cover.ProfileBlock{StartLine: 1, StartCol: 2, EndLine: 1, EndCol: 3},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := overlaps(&tc.b1, &tc.b2)
+			if actual != tc.expected {
+				t.Error("overlaps fail", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeDuplicate(t *testing.T) {
+	disjoint := append(newProfileOne(), newDisjoint()...)
+	disjointExpected := append(newCombined("github.com/repo/gocovdedup/alt.go"), newCombined("")...)
+	overlapped := append(newProfileOne(), newProfileOne()...)
+	// Test the deduplication logic
+	testCases := []struct {
+		name     string
+		profiles []*cover.Profile
+		expected []*cover.Profile
+	}{
+		{
+			name:     "empty",
+			expected: []*cover.Profile{},
+		},
+		{
+			name:     "combined",
+			profiles: newProfileOne(),
+			expected: newCombined(""),
+		},
+		{
+			name:     "disjoint",
+			profiles: disjoint,
+			expected: disjointExpected,
+		},
+		{
+			name:     "overlapped",
+			profiles: overlapped,
+			expected: newCombined(""),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := DeDuplicate(tc.profiles)
+			if len(actual) != len(tc.expected) {
+				t.Fatal("len wrong", tc.expected, actual)
+			}
+			for i, v := range tc.expected {
+				if !reflect.DeepEqual(v, actual[i]) {
+					t.Errorf("order fail %d\n%v\n%v", i, v, actual[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMergeCount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		a, b     int
+		expected int
+	}{
+		{"set", ModeSet, 1, 1, 1},
+		{"set unhit", ModeSet, 0, 1, 1},
+		{"count", ModeCount, 3, 4, 7},
+		{"atomic", ModeAtomic, 0, 2, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := mergeCount(tc.mode, tc.a, tc.b)
+			if actual != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeDuplicateCountMode(t *testing.T) {
+	newRun := func(counts ...int) *cover.Profile {
+		p := &cover.Profile{FileName: "a.go", Mode: ModeCount}
+		for i, c := range counts {
+			p.Blocks = append(p.Blocks, cover.ProfileBlock{StartLine: i*10 + 1, StartCol: 2, EndLine: i*10 + 3, EndCol: 4, NumStmt: 1, Count: c})
+		}
+		return p
+	}
+
+	testCases := []struct {
+		name     string
+		profiles []*cover.Profile
+		expected []cover.ProfileBlock
+	}{
+		{
+			name:     "identical summed",
+			profiles: []*cover.Profile{newRun(2, 0), newRun(3, 1), newRun(0, 4)},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 1, Count: 5},
+				{StartLine: 11, StartCol: 2, EndLine: 13, EndCol: 4, NumStmt: 1, Count: 5},
+			},
+		},
+		{
+			name: "partial overlap keeps max",
+			profiles: []*cover.Profile{
+				newRun(2),
+				{FileName: "a.go", Mode: ModeCount, Blocks: []cover.ProfileBlock{
+					{StartLine: 2, StartCol: 1, EndLine: 5, EndCol: 1, NumStmt: 2, Count: 7},
+				}},
+				newRun(3),
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 2, EndLine: 5, EndCol: 1, NumStmt: 2, Count: 7},
+			},
+		},
+		{
+			name: "set mode unions",
+			profiles: []*cover.Profile{
+				{FileName: "a.go", Mode: ModeSet, Blocks: []cover.ProfileBlock{{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1}}},
+				{FileName: "a.go", Mode: ModeSet, Blocks: []cover.ProfileBlock{{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1}}},
+			},
+			expected: []cover.ProfileBlock{{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := DeDuplicate(tc.profiles)
+			if len(actual) != 1 {
+				t.Fatal("len wrong", len(actual))
+			}
+			if !reflect.DeepEqual(actual[0].Blocks, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual[0].Blocks)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+// Package covmerge merges and deduplicates Go cover profiles.
+//
+// Profiles from several test runs are added to a Merger, which combines the
+// blocks of each source file and merges the overlapping blocks using one of
+// the merge strategies.  Inputs may be go cover profiles, LCOV tracefiles or
+// binary coverage directories written to GOCOVERDIR.
+package covmerge
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/tools/cover"
+)
+
+// Options configure a Merger.  The zero value unions overlapping blocks and
+// fails when the inputs have different cover modes.
+type Options struct {
+	// Mode converts every profile to the cover mode, set, count or atomic,
+	// instead of failing on mixed modes.
+	Mode string
+
+	// Strategy is the block merge strategy, StrategyUnion if empty.
+	Strategy string
+
+	// Src is a directory within the Go module holding the source files, used
+	// by StrategySource, SkipGenerated and Directives.  Defaults to ".".
+	Src string
+
+	// Include keeps only the files matching the gitignore style patterns and
+	// the patterns in the IncludeFiles, a trailing /... matches everything
+	// below a path.  Patterns may also be relative to the module containing
+	// Src.  Merging fails if the patterns match none of the files.
+	Include      []string
+	IncludeFiles []string
+
+	// IgnoreFiles are gitignore style exclusion files, layered in order so
+	// the last file matching a profile decides.  Missing files are skipped.
+	IgnoreFiles []string
+
+	// SkipGenerated drops generated source files.
+	SkipGenerated bool
+
+	// Directives removes the blocks excluded by //coverage:ignore comments.
+	Directives bool
+
+	// Rewrites are applied in order to the file names of each added profile.
+	Rewrites []Rewrite
+
+	// Provenance records the ranges each input covered, see Merger.Inputs.
+	Provenance bool
+
+	// MaxBlocks limits the blocks held in memory while inputs are added.
+	// Beyond it the blocks are sorted and spilled to temporary files in
+	// TempDir, to be merged back a file at a time, so inputs larger than
+	// memory can be merged.  Zero holds every block in memory.  It cannot be
+	// used with Provenance.
+	MaxBlocks int
+
+	// TempDir is the directory of the spilled blocks, os.TempDir if empty.
+	TempDir string
+
+	// Workers limits the inputs AddFiles parses and the files Merge merges
+	// at once.  Zero uses GOMAXPROCS and one works through them in order.
+	Workers int
+
+	// Warn receives the problems that do not stop the merge, such as source
+	// files that cannot be found.  It is not called concurrently.  Nil
+	// discards them.
+	Warn func(err error)
+}
+
+// Merger merges the profiles added to it.
+type Merger struct {
+	opts     Options
+	modes    *modeReconciler
+	resolver *Resolver
+	merge    blockMerger
+	profiles []*cover.Profile
+	inputs   []Input
+	spill    *spiller
+	filter   *fileFilter
+	sources  []source
+	warnMu   sync.Mutex
+}
+
+// New creates a Merger, checking the options.
+func New(opts Options) (*Merger, error) {
+	if opts.Mode != "" && !validMode(opts.Mode) {
+		return nil, fmt.Errorf("unknown cover mode %q", opts.Mode)
+	}
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyUnion
+	}
+	if opts.Src == "" {
+		opts.Src = "."
+	}
+
+	if opts.Workers < 0 {
+		return nil, fmt.Errorf("invalid worker count %d", opts.Workers)
+	}
+	if opts.MaxBlocks < 0 {
+		return nil, fmt.Errorf("invalid block limit %d", opts.MaxBlocks)
+	}
+	if opts.MaxBlocks > 0 && opts.Provenance {
+		return nil, errors.New("provenance cannot be recorded when spilling blocks")
+	}
+
+	m := &Merger{opts: opts, modes: &modeReconciler{target: opts.Mode}}
+
+	if opts.Strategy == StrategySource || opts.SkipGenerated || opts.Directives {
+		resolver, err := NewResolver(opts.Src)
+		if err != nil {
+			return nil, err
+		}
+		m.resolver = resolver
+	}
+
+	switch opts.Strategy {
+	case StrategyUnion:
+		m.merge = mergeWith(unionBlocks)
+	case StrategySplit:
+		m.merge = mergeWith(splitBlocks)
+	case StrategySource:
+		m.merge = m.mergeSource
+	default:
+		return nil, fmt.Errorf("unknown merge strategy %q", opts.Strategy)
+	}
+
+	if opts.MaxBlocks > 0 {
+		if err := m.startSpilling(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Add adds the profiles of an input.  The name identifies the input in
+// errors and provenance.  The profiles are converted to the merge's cover
+// mode and renamed by the rewrite rules.
+func (m *Merger) Add(name string, profiles []*cover.Profile) error {
+	if m.spill != nil {
+		return m.spillProfiles(name, profiles)
+	}
+
+	if err := m.modes.reconcile(name, profiles); err != nil {
+		return err
+	}
+	rewriteProfiles(profiles, m.opts.Rewrites)
+
+	if m.opts.Provenance {
+		m.inputs = append(m.inputs, newInput(name, profiles))
+	}
+	m.profiles = append(m.profiles, profiles...)
+	return nil
+}
+
+// AddReader adds the go cover or LCOV profile data read from r.  When
+// blocks are spilled the data is read a line at a time, so a failing input
+// may have been partly added.
+func (m *Merger) AddReader(name string, r io.Reader) error {
+	if m.spill != nil {
+		return m.spillReader(name, r)
+	}
+
+	profiles, err := ParseProfiles(r)
+	if err != nil {
+		return err
+	}
+	return m.Add(name, profiles)
+}
+
+// AddFile adds a cover profile, LCOV tracefile or binary coverage directory.
+func (m *Merger) AddFile(path string) error {
+	if m.spill != nil {
+		return m.spillFile(path)
+	}
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	return m.Add(path, profiles)
+}
+
+// AddFiles adds each file as AddFile does, parsing the files concurrently
+// but adding them in order, so the result does not depend on which is
+// parsed first.  When blocks are spilled the files are read in turn.
+func (m *Merger) AddFiles(paths ...string) error {
+	if m.spill != nil {
+		for _, path := range paths {
+			if err := m.spillFile(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	loaded, err := LoadAllProfiles(paths, m.opts.Workers)
+	if err != nil {
+		return err
+	}
+	for i, path := range paths {
+		if err := m.Add(path, loaded[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inputs returns the inputs added so far when Provenance is set.
+func (m *Merger) Inputs() []Input {
+	return m.inputs
+}
+
+// Merge filters and merges the added profiles, returning one profile per
+// file sorted by file name.  The added profiles are modified and the Merger
+// is left empty, ready for the next merge.
+func (m *Merger) Merge() ([]*cover.Profile, error) {
+	if m.spill != nil {
+		var merged []*cover.Profile
+		err := m.MergeEach(func(profile *cover.Profile) error {
+			merged = append(merged, profile)
+			return nil
+		})
+		return merged, err
+	}
+
+	profiles := m.profiles
+	m.profiles = nil
+
+	profiles, err := includeProfiles(profiles, m.opts.Include, m.opts.IncludeFiles, m.includeModule())
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreFiles := make([]ignoreFile, len(m.opts.IgnoreFiles))
+	for i, path := range m.opts.IgnoreFiles {
+		ignoreFiles[i] = newIgnoreFile(path)
+	}
+	profiles, err = filterProfiles(profiles, ignoreFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.opts.SkipGenerated {
+		var warnings []error
+		profiles, warnings = skipGenerated(profiles, m.resolver)
+		m.warn(warnings)
+	}
+
+	m.modes.convert(profiles)
+	merged, err := mergeProfiles(profiles, m.merge, m.opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.opts.Directives {
+		m.warn(applyDirectives(merged, m.resolver))
+	}
+	return merged, nil
+}
+
+// MergeEach merges the added profiles as Merge does, passing each merged
+// file's profile to fn in file name order.  When blocks are spilled only the
+// file being merged is held in memory.  An error from fn stops the merge and
+// is returned.
+func (m *Merger) MergeEach(fn func(profile *cover.Profile) error) error {
+	if m.spill != nil {
+		return m.mergeSpilled(fn)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		return err
+	}
+	for _, profile := range merged {
+		if err := fn(profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close discards the added profiles, removing any spilled blocks.  It is
+// only needed when a Merger is abandoned without merging.
+func (m *Merger) Close() error {
+	m.profiles = nil
+	if m.spill != nil {
+		m.spill.reset()
+		m.sources = nil
+	}
+	return nil
+}
+
+// includeModule returns the module the include patterns may be relative to.
+func (m *Merger) includeModule() string {
+	if len(m.opts.Include) == 0 && len(m.opts.IncludeFiles) == 0 {
+		return ""
+	}
+	return srcModule(m.opts.Src)
+}
+
+// mergeSource maps a profile's blocks onto its source, falling back to
+// unionBlocks with a warning when the source cannot be found or parsed.
+func (m *Merger) mergeSource(profile *cover.Profile) ([]cover.ProfileBlock, error) {
+	blocks, err := m.resolver.mergeBlocks(profile)
+	if err != nil {
+		m.warn([]error{err})
+		return unionBlocks(profile.Mode, profile.Blocks), nil
+	}
+	return blocks, nil
+}
+
+// warn passes warnings to the Warn option, one call at a time as files may
+// be merged at once.
+func (m *Merger) warn(warnings []error) {
+	if m.opts.Warn == nil {
+		return
+	}
+	m.warnMu.Lock()
+	defer m.warnMu.Unlock()
+	for _, warning := range warnings {
+		m.opts.Warn(warning)
+	}
+}
@@ -0,0 +1,306 @@
+package covmerge
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+// addFiles creates a Merger and adds the files to it.
+func addFiles(opts Options, files ...string) (*Merger, error) {
+	m, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if err := m.AddFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func TestNewErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{"mode", Options{Mode: "sum"}, `unknown cover mode "sum"`},
+		{"strategy", Options{Strategy: "max"}, `unknown merge strategy "max"`},
+		{"workers", Options{Workers: -1}, "invalid worker count -1"},
+		{"max blocks", Options{MaxBlocks: -1}, "invalid block limit -1"},
+		{"provenance", Options{MaxBlocks: 10, Provenance: true}, "provenance cannot be recorded when spilling blocks"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.opts)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected %s, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewResolverError(t *testing.T) {
+	if _, err := New(Options{Strategy: StrategySource, Src: t.TempDir()}); err == nil {
+		t.Error("expected missing go.mod error")
+	}
+}
+
+func TestMergerMerge(t *testing.T) {
+	testCases := []struct {
+		name     string
+		strategy string
+	}{
+		{"union", StrategyUnion},
+		{"split", StrategySplit},
+		{"default", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := addFiles(Options{Strategy: tc.strategy}, "testdata/cover_1.out", "testdata/cover_2.out")
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+
+			merged, err := m.Merge()
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if len(merged) != 1 || merged[0].FileName != "github.com/repo/gocovdedup/main.go" {
+				t.Errorf("unexpected merge %v", fileNames(merged))
+			}
+
+			again, err := m.Merge()
+			if err != nil || len(again) != 0 {
+				t.Errorf("expected empty merger, got %v %v", again, err)
+			}
+		})
+	}
+}
+
+func TestMergerAddReader(t *testing.T) {
+	m, err := New(Options{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	data := "mode: set\nexample.com/p/p.go:1.1,2.2 1 1\n"
+	if err := m.AddReader("stdin", strings.NewReader(data)); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if err := m.AddReader("bad", strings.NewReader("mode: set\nbad\n")); err == nil {
+		t.Error("expected parse error")
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []cover.ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 1}}
+	if len(merged) != 1 || !reflect.DeepEqual(merged[0].Blocks, expected) {
+		t.Errorf("unexpected merge %v", merged)
+	}
+}
+
+func TestMergerAddFiles(t *testing.T) {
+	paths := []string{"testdata/cover_1.out", "testdata/covdata", "testdata/cover_2.out", "testdata/module/sample.out"}
+
+	m, err := addFiles(Options{Workers: 1, Provenance: true}, paths...)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	expected, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, opts := range []Options{{Workers: 4, Provenance: true}, {MaxBlocks: 5, TempDir: t.TempDir()}} {
+		m, err := New(opts)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if err := m.AddFiles(paths...); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if opts.Provenance && len(m.Inputs()) != len(paths) {
+			t.Errorf("expected %d inputs, got %d", len(paths), len(m.Inputs()))
+		}
+		for i, in := range m.Inputs() {
+			if in.Name != paths[i] {
+				t.Errorf("expected input %s, got %s", paths[i], in.Name)
+			}
+		}
+
+		merged, err := m.Merge()
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("expected %v, got %v", expected, merged)
+		}
+	}
+
+	m, err = New(Options{Workers: 4})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if err := m.AddFiles("testdata/cover_1.out", "testdata/missing.out"); err == nil {
+		t.Error("expected missing file error")
+	}
+}
+
+func TestMergerAddFileMissing(t *testing.T) {
+	m, err := New(Options{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if err := m.AddFile("testdata/missing.out"); err == nil {
+		t.Error("expected missing file error")
+	}
+}
+
+func TestMergerRewritesAndInputs(t *testing.T) {
+	m, err := New(Options{
+		Rewrites:   []Rewrite{PrefixRewrite("github.com/repo/gocovdedup", "example.com/p")},
+		Provenance: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	profiles := []*cover.Profile{{
+		FileName: "github.com/repo/gocovdedup/main.go",
+		Mode:     ModeSet,
+		Blocks:   []cover.ProfileBlock{{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 1}},
+	}}
+	if err := m.Add("one", profiles); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	inputs := m.Inputs()
+	if len(inputs) != 1 || inputs[0].Name != "one" {
+		t.Fatalf("unexpected inputs %v", inputs)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(merged) != 1 || merged[0].FileName != "example.com/p/main.go" {
+		t.Errorf("unexpected merge %v", fileNames(merged))
+	}
+	if !inputs[0].Hits(merged[0].FileName, &merged[0].Blocks[0]) {
+		t.Error("expected first block hit by input one")
+	}
+}
+
+func TestMergerFilters(t *testing.T) {
+	dir := t.TempDir()
+	ignore := filepath.Join(dir, ".covignore")
+	writeFile(t, ignore, "**/cmd/**\n")
+
+	var warnings []error
+	m, err := New(Options{
+		Src:           "testdata/module",
+		Include:       []string{"example.com/sample/..."},
+		IgnoreFiles:   []string{ignore, filepath.Join(dir, "missing")},
+		SkipGenerated: true,
+		Warn:          func(err error) { warnings = append(warnings, err) },
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	profiles := []*cover.Profile{
+		{FileName: "example.com/other/o.go", Mode: ModeSet},
+		{FileName: "example.com/sample/cmd/sample/main.go", Mode: ModeSet},
+		{FileName: "example.com/sample/gen.go", Mode: ModeSet},
+		{FileName: "example.com/sample/missing.go", Mode: ModeSet},
+		{FileName: "example.com/sample/sample.go", Mode: ModeSet},
+	}
+	if err := m.Add("profiles", profiles); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"example.com/sample/missing.go", "example.com/sample/sample.go"}
+	if actual := fileNames(merged); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning, got %v", warnings)
+	}
+}
+
+func TestMergerIncludeRelative(t *testing.T) {
+	files := []string{"testdata/module/sample.out", "testdata/cover_2.out"}
+	for _, maxBlocks := range []int{0, 2} {
+		opts := Options{Src: "testdata/module", Include: []string{"sample.go"}, MaxBlocks: maxBlocks, TempDir: t.TempDir()}
+		m, err := addFiles(opts, files...)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		merged, err := m.Merge()
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if actual := fileNames(merged); !reflect.DeepEqual(actual, []string{"example.com/sample/sample.go"}) {
+			t.Errorf("max blocks %d: unexpected files %v", maxBlocks, actual)
+		}
+
+		opts.Include = []string{"cmd/..."}
+		m, err = addFiles(opts, files...)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := m.Merge(); err != errNoneIncluded {
+			t.Errorf("max blocks %d: expected %v, got %v", maxBlocks, errNoneIncluded, err)
+		}
+		assertEmptyDir(t, opts.TempDir)
+	}
+}
+
+func TestMergerDirectives(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/p\n")
+	writeFile(t, filepath.Join(dir, "p.go"), directivesSrc)
+
+	var warnings []error
+	m, err := New(Options{Src: dir, Directives: true, Warn: func(err error) { warnings = append(warnings, err) }})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	profiles := []*cover.Profile{
+		{FileName: "example.com/p/missing.go", Mode: ModeSet, Blocks: []cover.ProfileBlock{{StartLine: 1, EndLine: 1, NumStmt: 1}}},
+		{FileName: "example.com/p/p.go", Mode: ModeSet, Blocks: []cover.ProfileBlock{
+			{StartLine: 4, StartCol: 10, EndLine: 6, EndCol: 2, NumStmt: 1},
+			{StartLine: 8, StartCol: 19, EndLine: 9, EndCol: 16, NumStmt: 1, Count: 1},
+		}},
+	}
+	if err := m.Add("profiles", profiles); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(merged) != 2 || len(merged[1].Blocks) != 1 {
+		t.Errorf("expected directive block removed, got %v", merged)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "source not found") {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+}
@@ -0,0 +1,116 @@
+package covmerge
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/cover"
+)
+
+// validMode reports whether mode is a known cover mode.
+func validMode(mode string) bool {
+	switch mode {
+	case ModeSet, ModeCount, ModeAtomic:
+		return true
+	}
+	return false
+}
+
+// modeReconciler checks that the profiles of every input share the same cover mode.
+// If a target mode is set, profiles are converted to it rather than checked.
+// Profiles read from LCOV tracefiles are not checked, they take the mode of
+// the other inputs when merged.
+type modeReconciler struct {
+	target  string
+	mode    string
+	source  string
+	adapted bool
+}
+
+// reconcile checks or converts the profiles read from source.
+func (r *modeReconciler) reconcile(source string, profiles []*cover.Profile) error {
+	for _, profile := range profiles {
+		if r.target == "" && isLCOVProfile(profile) {
+			r.adapt()
+			continue
+		}
+		mode, err := r.modeFor(source, profile.Mode)
+		if err != nil {
+			return err
+		}
+		convertMode(profile, mode)
+	}
+	return nil
+}
+
+// modeFor checks the cover mode of a profile read from source, returning
+// the mode it is converted to.
+func (r *modeReconciler) modeFor(source, mode string) (string, error) {
+	if r.target != "" {
+		return r.target, nil
+	}
+
+	if r.mode == "" {
+		r.mode, r.source = mode, source
+		return mode, nil
+	}
+
+	if mode != r.mode {
+		return "", fmt.Errorf("%s: cover mode %q conflicts with mode %q from %s, use -mode to convert", source, mode, r.mode, r.source)
+	}
+	return mode, nil
+}
+
+// adapt records an input that takes the mode of the others.
+func (r *modeReconciler) adapt() {
+	r.adapted = true
+}
+
+// merged returns the cover mode of the merged profiles, count mode when
+// every input took the mode of the others.
+func (r *modeReconciler) merged() string {
+	switch {
+	case r.target != "":
+		return r.target
+	case r.mode == "" && r.adapted:
+		return ModeCount
+	}
+	return r.mode
+}
+
+// convert converts the profiles not yet in the merged mode to it.
+func (r *modeReconciler) convert(profiles []*cover.Profile) {
+	mode := r.merged()
+	for _, profile := range profiles {
+		if profile.Mode != mode {
+			convertMode(profile, mode)
+		}
+	}
+}
+
+// isLCOVProfile reports whether a profile was read from an LCOV tracefile,
+// whose blocks each cover a whole line.
+func isLCOVProfile(profile *cover.Profile) bool {
+	for _, block := range profile.Blocks {
+		if block.EndCol != lcovEndCol {
+			return false
+		}
+	}
+	return len(profile.Blocks) > 0
+}
+
+// convertMode converts a profile to mode.  Converting to set mode turns the
+// counts into hit bits, the other conversions keep the counts.
+func convertMode(profile *cover.Profile, mode string) {
+	for i := range profile.Blocks {
+		profile.Blocks[i].Count = convertCount(profile.Mode, mode, profile.Blocks[i].Count)
+	}
+	profile.Mode = mode
+}
+
+// convertCount converts a block count from one cover mode to another.
+func convertCount(from, to string, count int) int {
+	if to == ModeSet && from != ModeSet && count > 0 {
+		return 1
+	}
+	return count
+}
@@ -0,0 +1,112 @@
+package covmerge
+
+import (
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestValidMode(t *testing.T) {
+	for _, mode := range []string{ModeSet, ModeCount, ModeAtomic} {
+		if !validMode(mode) {
+			t.Error("expected valid", mode)
+		}
+	}
+	if validMode("sum") {
+		t.Error("unexpected valid mode")
+	}
+}
+
+func TestReconcileConflict(t *testing.T) {
+	_, err := addFiles(Options{}, "testdata/cover_1.out", "testdata/cover_count.out")
+	if err == nil {
+		t.Fatal("expected conflict error")
+	}
+
+	expected := `testdata/cover_count.out: cover mode "count" conflicts with mode "set" from testdata/cover_1.out, use -mode to convert`
+	if err.Error() != expected {
+		t.Errorf("expected %s, got %s", expected, err)
+	}
+}
+
+func TestReconcileConvertSet(t *testing.T) {
+	m, err := addFiles(Options{Mode: ModeSet}, "testdata/cover_1.out", "testdata/cover_count.out")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	profiles := m.profiles
+
+	if len(profiles) != 2 {
+		t.Fatal("profiles len != 2", len(profiles))
+	}
+
+	for _, p := range profiles {
+		if p.Mode != ModeSet {
+			t.Errorf("expected set, got %s", p.Mode)
+		}
+		for _, b := range p.Blocks {
+			if b.Count > 1 {
+				t.Errorf("count not converted %v", b)
+			}
+		}
+	}
+}
+
+func TestReconcileLCOV(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    []string
+		expected string
+	}{
+		{"lcov last", []string{"testdata/cover_1.out", "testdata/cover.info"}, ModeSet},
+		{"lcov first", []string{"testdata/cover.info", "testdata/cover_count.out"}, ModeCount},
+		{"lcov only", []string{"testdata/cover.info"}, ModeCount},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, maxBlocks := range []int{0, 2} {
+				m, err := addFiles(Options{MaxBlocks: maxBlocks, TempDir: t.TempDir()}, tc.files...)
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+				merged, err := m.Merge()
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+
+				for _, p := range merged {
+					if p.Mode != tc.expected {
+						t.Errorf("max blocks %d: expected %s, got %s", maxBlocks, tc.expected, p.Mode)
+					}
+					for _, b := range p.Blocks {
+						if (tc.expected == ModeSet && b.Count > 1) || b.StartCol == lcovEndCol || b.EndCol == lcovEndCol {
+							t.Errorf("max blocks %d: unexpected block %v", maxBlocks, b)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileUnknownMode(t *testing.T) {
+	if _, err := New(Options{Mode: "sum"}); err == nil {
+		t.Fatal("expected unknown mode error")
+	}
+}
+
+func TestConvertMode(t *testing.T) {
+	profile := &cover.Profile{Mode: ModeSet, Blocks: []cover.ProfileBlock{{Count: 1}, {Count: 0}}}
+	convertMode(profile, ModeAtomic)
+	if profile.Mode != ModeAtomic || profile.Blocks[0].Count != 1 || profile.Blocks[1].Count != 0 {
+		t.Errorf("unexpected conversion %+v", profile)
+	}
+
+	profile = &cover.Profile{Mode: ModeCount, Blocks: []cover.ProfileBlock{{Count: 7}, {Count: 0}}}
+	convertMode(profile, ModeSet)
+	if profile.Mode != ModeSet || profile.Blocks[0].Count != 1 || profile.Blocks[1].Count != 0 {
+		t.Errorf("unexpected conversion %+v", profile)
+	}
+}
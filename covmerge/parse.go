@@ -0,0 +1,208 @@
+package covmerge
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// lcovEndCol is the end column of the single line blocks created from LCOV
+// line records, it extends the block to the end of its line.  Merged blocks
+// end at the start of the next line instead, see endLines.
+const lcovEndCol = math.MaxInt32
+
+// parseProfileFile reads a go cover profile or LCOV tracefile from file.
+func parseProfileFile(file string) ([]*cover.Profile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseProfiles(f)
+}
+
+// ParseProfiles reads go cover or LCOV profile data, the format is detected from the content.
+func ParseProfiles(r io.Reader) ([]*cover.Profile, error) {
+	br := bufio.NewReader(r)
+	if isLCOV(br) {
+		return parseLCOV(br)
+	}
+	return cover.ParseProfilesFromReader(br)
+}
+
+// isLCOV peeks at the first line to see if the data is an LCOV tracefile.
+func isLCOV(r *bufio.Reader) bool {
+	// Peek returns what it can along with an error for short input
+	peek, _ := r.Peek(r.Size())
+	peek = bytes.TrimLeft(peek, " \t\r\n")
+	return bytes.HasPrefix(peek, []byte("TN:")) || bytes.HasPrefix(peek, []byte("SF:"))
+}
+
+// parseLCOV converts the line records of an LCOV tracefile into count mode
+// profiles, each line becoming a single statement block.
+func parseLCOV(r io.Reader) ([]*cover.Profile, error) {
+	files := make(map[string]*cover.Profile)
+	err := scanLCOV(r, func(fileName, mode string, block cover.ProfileBlock) error {
+		profile := files[fileName]
+		if profile == nil {
+			profile = &cover.Profile{FileName: fileName, Mode: mode}
+			files[fileName] = profile
+		}
+		profile.Blocks = append(profile.Blocks, block)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*cover.Profile, 0, len(files))
+	for _, profile := range files {
+		sort.Sort(orderedBlocks(profile.Blocks))
+		profiles = append(profiles, profile)
+	}
+	sort.Sort(byFileName(profiles))
+	return profiles, nil
+}
+
+// blockFunc receives each block read from profile data along with the
+// name of its file and the cover mode.
+type blockFunc func(fileName, mode string, block cover.ProfileBlock) error
+
+// scanProfiles reads go cover or LCOV profile data a line at a time, passing
+// each block to fn in the order read.  Unlike ParseProfiles the blocks are
+// neither sorted nor combined.  It reports whether the data was LCOV.
+func scanProfiles(r io.Reader, fn blockFunc) (bool, error) {
+	br := bufio.NewReader(r)
+	if isLCOV(br) {
+		return true, scanLCOV(br, fn)
+	}
+	return false, scanCover(br, fn)
+}
+
+// scanLCOV reads the line records of an LCOV tracefile as count mode
+// blocks.  Records other than source files and line data are ignored.
+func scanLCOV(r io.Reader, fn blockFunc) error {
+	current := ""
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			current = strings.TrimPrefix(line, "SF:")
+		case line == "end_of_record":
+			current = ""
+		case strings.HasPrefix(line, "DA:"):
+			if current == "" {
+				return fmt.Errorf("lcov line %d: line data outside a source file record", lineNo)
+			}
+			block, err := parseLCOVLine(strings.TrimPrefix(line, "DA:"))
+			if err != nil {
+				return fmt.Errorf("lcov line %d: %w", lineNo, err)
+			}
+			if err := fn(current, ModeCount, block); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// scanCover reads a go cover profile, which starts with a mode line followed
+// by a line per block, reporting errors as cover.ParseProfilesFromReader does.
+func scanCover(r io.Reader, fn blockFunc) error {
+	mode := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if mode == "" {
+			const prefix = "mode: "
+			if !strings.HasPrefix(line, prefix) || line == prefix {
+				return fmt.Errorf("bad mode line: %v", line)
+			}
+			mode = line[len(prefix):]
+			continue
+		}
+
+		fileName, block, err := parseCoverLine(line)
+		if err != nil {
+			return fmt.Errorf("line %q doesn't match expected format: %v", line, err)
+		}
+		if err := fn(fileName, mode, block); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseCoverLine parses a go cover profile block line, which has the form
+// name.go:line.column,line.column numberOfStatements count.
+func parseCoverLine(line string) (string, cover.ProfileBlock, error) {
+	var b cover.ProfileBlock
+	fields := []struct {
+		sep   byte
+		value *int
+		name  string
+	}{
+		{' ', &b.Count, "Count"},
+		{' ', &b.NumStmt, "NumStmt"},
+		{'.', &b.EndCol, "EndCol"},
+		{',', &b.EndLine, "EndLine"},
+		{'.', &b.StartCol, "StartCol"},
+		{':', &b.StartLine, "StartLine"},
+	}
+
+	rest := line
+	for _, field := range fields {
+		i := strings.LastIndexByte(rest, field.sep)
+		if i < 0 {
+			return "", b, fmt.Errorf("couldn't find a %s", field.name)
+		}
+		value, err := strconv.Atoi(rest[i+1:])
+		if err != nil || value < 0 {
+			return "", b, fmt.Errorf("couldn't parse %s %q", field.name, rest[i+1:])
+		}
+		*field.value, rest = value, rest[:i]
+	}
+
+	if rest == "" {
+		return "", b, fmt.Errorf("missing file name")
+	}
+	return rest, b, nil
+}
+
+// parseLCOVLine parses the line number and count of a DA record, an optional checksum is ignored.
+func parseLCOVLine(data string) (cover.ProfileBlock, error) {
+	fields := strings.Split(data, ",")
+	if len(fields) < 2 {
+		return cover.ProfileBlock{}, fmt.Errorf("bad line data %q", data)
+	}
+
+	line, err := strconv.Atoi(fields[0])
+	if err != nil || line < 1 {
+		return cover.ProfileBlock{}, fmt.Errorf("bad line number %q", fields[0])
+	}
+
+	count, err := strconv.Atoi(fields[1])
+	if err != nil || count < 0 {
+		return cover.ProfileBlock{}, fmt.Errorf("bad execution count %q", fields[1])
+	}
+
+	return cover.ProfileBlock{
+		StartLine: line,
+		StartCol:  1,
+		EndLine:   line,
+		EndCol:    lcovEndCol,
+		NumStmt:   1,
+		Count:     count,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package covmerge
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestIsLCOV(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{"cover", "mode: set\n", false},
+		{"test name", "TN:\nSF:a.go\n", true},
+		{"source file", "\nSF:a.go\n", true},
+		{"empty", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := isLCOV(bufio.NewReader(strings.NewReader(tc.data))); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseProfileFileLCOV(t *testing.T) {
+	profiles, err := parseProfileFile("testdata/cover.info")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []*cover.Profile{
+		{
+			FileName: "github.com/repo/gocovdedup/main.go",
+			Mode:     ModeCount,
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 18, StartCol: 1, EndLine: 18, EndCol: lcovEndCol, NumStmt: 1, Count: 2},
+				{StartLine: 20, StartCol: 1, EndLine: 20, EndCol: lcovEndCol, NumStmt: 1, Count: 0},
+				{StartLine: 33, StartCol: 1, EndLine: 33, EndCol: lcovEndCol, NumStmt: 1, Count: 1},
+			},
+		},
+		{
+			FileName: "github.com/repo/gocovdedup/other.go",
+			Mode:     ModeCount,
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 5, StartCol: 1, EndLine: 5, EndCol: lcovEndCol, NumStmt: 1, Count: 4},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("expected %v, got %v", expected, profiles)
+	}
+}
+
+func TestParseLCOVErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"outside record", "TN:\nDA:1,1\n", "lcov line 2: line data outside a source file record"},
+		{"bad data", "SF:a.go\nDA:1\n", `lcov line 2: bad line data "1"`},
+		{"bad line", "SF:a.go\nDA:x,1\n", `lcov line 2: bad line number "x"`},
+		{"bad count", "SF:a.go\nDA:1,-1\n", `lcov line 2: bad execution count "-1"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseProfiles(strings.NewReader(tc.data))
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected %s, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestMergeMixedFormats(t *testing.T) {
+	m, err := addFiles(Options{Mode: ModeCount}, "testdata/cover_1.out", "testdata/cover.info")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(merged) != 2 {
+		t.Fatal("merged len != 2", len(merged))
+	}
+
+	// line 18 falls in the 17.76,19.22 block so the two are merged
+	expected := cover.ProfileBlock{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 2}
+	if merged[0].Blocks[0] != expected {
+		t.Errorf("expected %v, got %v", expected, merged[0].Blocks[0])
+	}
+
+	// a line on its own ends at the start of the next line
+	expected = cover.ProfileBlock{StartLine: 5, StartCol: 1, EndLine: 6, EndCol: 1, NumStmt: 1, Count: 4}
+	if merged[1].Blocks[0] != expected {
+		t.Errorf("expected %v, got %v", expected, merged[1].Blocks[0])
+	}
+}
+
+func TestScanCoverMatchesParser(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{"profile", "mode: count\na b.go:1.2,3.4 5 6\nb.go:7.8,9.10 1 0\n"},
+		{"no mode", "a.go:1.2,3.4 5 6\n"},
+		{"empty mode", "mode: \n"},
+		{"no count", "mode: set\na.go:1.2,3.4 5\n"},
+		{"negative", "mode: set\na.go:1.2,3.4 5 -1\n"},
+		{"no name", "mode: set\n:1.2,3.4 5 1\n"},
+		{"no colon", "mode: set\na.go1.2,3.4 5 1\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected, expectedErr := cover.ParseProfilesFromReader(strings.NewReader(tc.data))
+
+			var blocks int
+			err := scanCover(strings.NewReader(tc.data), func(fileName, mode string, block cover.ProfileBlock) error {
+				blocks++
+				return nil
+			})
+			// the messages agree up to the detail of what failed to parse
+			if errorPrefix(err) != errorPrefix(expectedErr) {
+				t.Fatalf("expected %v, got %v", expectedErr, err)
+			}
+			for _, profile := range expected {
+				blocks -= len(profile.Blocks)
+			}
+			if blocks != 0 {
+				t.Errorf("unexpected block count difference %d", blocks)
+			}
+		})
+	}
+}
+
+func TestParseCoverLine(t *testing.T) {
+	fileName, block, err := parseCoverLine("example.com/a b.go:1.2,3.4 5 6")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := cover.ProfileBlock{StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 5, Count: 6}
+	if fileName != "example.com/a b.go" || block != expected {
+		t.Errorf("unexpected %s %v", fileName, block)
+	}
+}
+
+func errorPrefix(err error) string {
+	if err == nil {
+		return ""
+	}
+	prefix, _, _ := strings.Cut(err.Error(), ":")
+	return prefix
+}
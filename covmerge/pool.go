@@ -0,0 +1,83 @@
+package covmerge
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/tools/cover"
+)
+
+// workerCount returns the number of goroutines used for jobs, GOMAXPROCS
+// when workers is not positive, but never more than there are jobs.
+func workerCount(workers, jobs int) int {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > jobs {
+		workers = jobs
+	}
+	return workers
+}
+
+// forEach calls fn with each index below n using up to workers goroutines.
+// No more indexes are started once one fails, and the error returned is that
+// of the lowest failing index, the same error running them in order would
+// have returned.
+func forEach(n, workers int, fn func(i int) error) error {
+	workers = workerCount(workers, n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+	var failed atomic.Bool
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if errs[i] = fn(i); errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n && !failed.Load(); i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadAllProfiles loads each path as LoadProfiles does, parsing up to
+// workers of them at once, GOMAXPROCS when workers is not positive.  The
+// profiles are returned in the order of the paths.
+func LoadAllProfiles(paths []string, workers int) ([][]*cover.Profile, error) {
+	loaded := make([][]*cover.Profile, len(paths))
+	err := forEach(len(paths), workers, func(i int) error {
+		profiles, err := LoadProfiles(paths[i])
+		loaded[i] = profiles
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
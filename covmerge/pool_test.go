@@ -0,0 +1,106 @@
+package covmerge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkerCount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		workers  int
+		jobs     int
+		expected int
+	}{
+		{"default", 0, 1000, runtime.GOMAXPROCS(0)},
+		{"negative", -1, 1000, runtime.GOMAXPROCS(0)},
+		{"bounded", 4, 1000, 4},
+		{"few jobs", 8, 3, 3},
+		{"no jobs", 8, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := workerCount(tc.workers, tc.jobs); actual != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			var running, peak int32
+			done := make([]bool, 100)
+			err := forEach(len(done), workers, func(i int) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				done[i] = true
+				return nil
+			})
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			for i, d := range done {
+				if !d {
+					t.Fatalf("index %d not run", i)
+				}
+			}
+			if peak > int32(workers) {
+				t.Errorf("expected at most %d running, got %d", workers, peak)
+			}
+		})
+	}
+}
+
+func TestForEachError(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			err := forEach(100, workers, func(i int) error {
+				if i%10 == 7 {
+					return fmt.Errorf("failed %d", i)
+				}
+				return nil
+			})
+			if err == nil || err.Error() != "failed 7" {
+				t.Errorf("expected the first failure, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadAllProfiles(t *testing.T) {
+	paths := []string{"testdata/cover_2.out", "testdata/cover.info", "testdata/cover_1.out"}
+	loaded, err := LoadAllProfiles(paths, 2)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for i, path := range paths {
+		expected, err := LoadProfiles(path)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if !reflect.DeepEqual(loaded[i], expected) {
+			t.Errorf("%s: expected %v, got %v", path, expected, loaded[i])
+		}
+	}
+
+	_, err = LoadAllProfiles([]string{"testdata/cover_1.out", "testdata/missing.out", "testdata/nofile.out"}, 2)
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "testdata/missing.out" {
+		t.Errorf("expected missing.out error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package covmerge
+
+import (
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// Input records the source ranges an input covered, taken before merging
+// modifies the loaded profiles.
+type Input struct {
+	// Name is the name the input was added with.
+	Name    string
+	covered map[string][]span
+}
+
+// newInput records the covered ranges of an input's profiles.  The ranges of
+// each file are sorted and overlapping ranges joined, so they can be searched.
+func newInput(name string, profiles []*cover.Profile) Input {
+	in := Input{Name: name, covered: make(map[string][]span)}
+	for _, profile := range profiles {
+		for _, b := range profile.Blocks {
+			if b.Count > 0 {
+				in.covered[profile.FileName] = append(in.covered[profile.FileName], span{
+					start: position{b.StartLine, b.StartCol},
+					end:   position{b.EndLine, b.EndCol},
+				})
+			}
+		}
+	}
+
+	for fileName, spans := range in.covered {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].start.before(spans[j].start) })
+		joined := spans[:1]
+		for _, s := range spans[1:] {
+			last := &joined[len(joined)-1]
+			if s.start.before(last.end) || s.start == last.end {
+				if last.end.before(s.end) {
+					last.end = s.end
+				}
+				continue
+			}
+			joined = append(joined, s)
+		}
+		in.covered[fileName] = joined
+	}
+	return in
+}
+
+// Hits reports whether the input covered any part of the block.
+func (in Input) Hits(fileName string, b *cover.ProfileBlock) bool {
+	spans := in.covered[fileName]
+	start, end := position{b.StartLine, b.StartCol}, position{b.EndLine, b.EndCol}
+
+	// the first covered range ending after the block starts
+	i := sort.Search(len(spans), func(i int) bool { return start.before(spans[i].end) })
+	return i < len(spans) && spans[i].start.before(end)
+}
@@ -0,0 +1,69 @@
+package covmerge
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestNewInput(t *testing.T) {
+	profiles := []*cover.Profile{
+		{FileName: "a.go", Blocks: []cover.ProfileBlock{
+			{StartLine: 5, StartCol: 1, EndLine: 6, EndCol: 2, NumStmt: 1, Count: 1},
+			{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 1, Count: 1},
+			{StartLine: 2, StartCol: 5, EndLine: 3, EndCol: 2, NumStmt: 1, Count: 2},
+			{StartLine: 3, StartCol: 2, EndLine: 4, EndCol: 2, NumStmt: 1, Count: 0},
+		}},
+		{FileName: "a.go", Blocks: []cover.ProfileBlock{
+			{StartLine: 5, StartCol: 5, EndLine: 8, EndCol: 2, NumStmt: 1, Count: 1},
+		}},
+		{FileName: "b.go", Blocks: []cover.ProfileBlock{
+			{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 0},
+		}},
+	}
+
+	in := newInput("unit.out", profiles)
+
+	expected := map[string][]span{
+		"a.go": {
+			{start: position{1, 1}, end: position{3, 2}},
+			{start: position{5, 1}, end: position{8, 2}},
+		},
+	}
+	if !reflect.DeepEqual(in.covered, expected) {
+		t.Errorf("expected %v, got %v", expected, in.covered)
+	}
+}
+
+func TestInputHits(t *testing.T) {
+	in := Input{covered: map[string][]span{
+		"a.go": {
+			{start: position{1, 1}, end: position{3, 2}},
+			{start: position{5, 1}, end: position{8, 2}},
+		},
+	}}
+
+	testCases := []struct {
+		name     string
+		file     string
+		block    cover.ProfileBlock
+		expected bool
+	}{
+		{"inside", "a.go", cover.ProfileBlock{StartLine: 1, StartCol: 5, EndLine: 2, EndCol: 1}, true},
+		{"overlaps end", "a.go", cover.ProfileBlock{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 1}, true},
+		{"touches end", "a.go", cover.ProfileBlock{StartLine: 3, StartCol: 2, EndLine: 4, EndCol: 1}, false},
+		{"between", "a.go", cover.ProfileBlock{StartLine: 4, StartCol: 1, EndLine: 5, EndCol: 1}, false},
+		{"spans", "a.go", cover.ProfileBlock{StartLine: 4, StartCol: 1, EndLine: 9, EndCol: 1}, true},
+		{"after", "a.go", cover.ProfileBlock{StartLine: 9, StartCol: 1, EndLine: 9, EndCol: 5}, false},
+		{"other file", "b.go", cover.ProfileBlock{StartLine: 1, StartCol: 5, EndLine: 2, EndCol: 1}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := in.Hits(tc.file, &tc.block); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package covmerge
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Resolver maps profile file names, which are package import paths,
+// to source files on disk using the enclosing Go module.
+type Resolver struct {
+	root       string
+	modulePath string
+}
+
+// NewResolver creates a resolver for the module containing dir.
+func NewResolver(dir string) (*Resolver, error) {
+	root, err := findModuleRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	modulePath, err := readModulePath(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolver{root: root, modulePath: modulePath}, nil
+}
+
+// findModuleRoot walks up from dir to the first directory holding a go.mod file.
+func findModuleRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("unable to find go.mod, source files cannot be resolved")
+		}
+		dir = parent
+	}
+}
+
+// readModulePath reads the module path declared in a go.mod file.
+func readModulePath(goMod string) (string, error) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(fields[1]); err == nil {
+			return unquoted, nil
+		}
+		return fields[1], nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s: no module declaration", goMod)
+}
+
+// Resolve returns the path of the source file for a profile file name.
+func (r *Resolver) Resolve(fileName string) (string, error) {
+	var path string
+	switch {
+	case filepath.IsAbs(fileName):
+		path = fileName
+	case strings.HasPrefix(fileName, r.modulePath+"/"):
+		path = filepath.Join(r.root, filepath.FromSlash(strings.TrimPrefix(fileName, r.modulePath+"/")))
+	default:
+		path = filepath.Join(r.root, filepath.FromSlash(fileName))
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s: source not found in module %s", fileName, r.modulePath)
+	}
+	return path, nil
+}
+
+// Root returns the directory of the module.
+func (r *Resolver) Root() string {
+	return r.root
+}
+
+// ModulePath returns the module path declared in the module's go.mod.
+func (r *Resolver) ModulePath() string {
+	return r.modulePath
+}
+
+// Rel returns the slash separated path of the source file for a profile file
+// name relative to the module root.  It returns false when the file is not
+// found within the module.
+func (r *Resolver) Rel(fileName string) (string, bool) {
+	path, err := r.Resolve(fileName)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
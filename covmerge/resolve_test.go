@@ -0,0 +1,121 @@
+package covmerge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSourceResolver(t *testing.T) {
+	r, err := NewResolver("testdata/module")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if r.modulePath != "example.com/sample" {
+		t.Errorf("expected example.com/sample, got %s", r.modulePath)
+	}
+
+	abs, _ := filepath.Abs("testdata/module")
+	if r.root != abs {
+		t.Errorf("expected %s, got %s", abs, r.root)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r, err := NewResolver("testdata/module")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	abs, _ := filepath.Abs("testdata/module/sample.go")
+
+	testCases := []struct {
+		name     string
+		fileName string
+		expected string
+		err      bool
+	}{
+		{"import path", "example.com/sample/sample.go", abs, false},
+		{"relative", "sample.go", abs, false},
+		{"absolute", abs, abs, false},
+		{"missing", "example.com/sample/missing.go", "", true},
+		{"other module", "example.com/other/sample.go", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := r.Resolve(tc.fileName)
+			if (err != nil) != tc.err {
+				t.Fatal("unexpected error", err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRel(t *testing.T) {
+	r, err := NewResolver("testdata/module")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	outside, _ := filepath.Abs("testdata/cover_1.out")
+
+	testCases := []struct {
+		name     string
+		fileName string
+		expected string
+		ok       bool
+	}{
+		{"import path", "example.com/sample/sample.go", "sample.go", true},
+		{"sub package", "example.com/sample/cmd/sample/main.go", "cmd/sample/main.go", true},
+		{"missing", "example.com/sample/missing.go", "", false},
+		{"outside module", outside, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, ok := r.Rel(tc.fileName)
+			if actual != tc.expected || ok != tc.ok {
+				t.Errorf("expected %s %v, got %s %v", tc.expected, tc.ok, actual, ok)
+			}
+		})
+	}
+}
+
+func TestReadModulePath(t *testing.T) {
+	dir := t.TempDir()
+	goMod := filepath.Join(dir, "go.mod")
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"plain", "module example.com/a\n\ngo 1.20\n", "example.com/a"},
+		{"comment", "// a module\nmodule example.com/b // trailing\n", "example.com/b"},
+		{"quoted", "module \"example.com/c\"\n", "example.com/c"},
+		{"missing", "go 1.20\n", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(goMod, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			actual, err := readModulePath(goMod)
+			if tc.expected == "" {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil || actual != tc.expected {
+				t.Errorf("expected %s, got %s %v", tc.expected, actual, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package covmerge
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// Rewrite maps profile file names onto a canonical name, either by replacing
+// a path prefix or by a regular expression substitution.
+type Rewrite struct {
+	from string
+	to   string
+	re   *regexp.Regexp
+}
+
+// PrefixRewrite creates a rule replacing the leading from of a file name with to.
+func PrefixRewrite(from, to string) Rewrite {
+	return Rewrite{from: from, to: to}
+}
+
+// RegexpRewrite creates a rule replacing the matches of expr with replacement,
+// which may refer to groups using $1 or ${name}.
+func RegexpRewrite(expr, replacement string) (Rewrite, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rewrite{}, err
+	}
+	return Rewrite{from: expr, to: replacement, re: re}, nil
+}
+
+// Apply returns name rewritten by the rule.  Prefixes only match whole path
+// elements, so a rule for example.com/fork leaves example.com/forked alone.
+func (r Rewrite) Apply(name string) string {
+	if r.re != nil {
+		return r.re.ReplaceAllString(name, r.to)
+	}
+
+	if !strings.HasPrefix(name, r.from) {
+		return name
+	}
+	rest := name[len(r.from):]
+	if rest != "" && rest[0] != '/' && !strings.HasSuffix(r.from, "/") {
+		return name
+	}
+	return r.to + rest
+}
+
+// IsRegexp reports whether the rule is a regular expression substitution.
+func (r Rewrite) IsRegexp() bool {
+	return r.re != nil
+}
+
+// String returns the rule in from=to form.
+func (r Rewrite) String() string {
+	return r.from + "=" + r.to
+}
+
+// rewriteName applies each rule in order to the result of the previous one.
+func rewriteName(name string, rules []Rewrite) string {
+	for _, r := range rules {
+		name = r.Apply(name)
+	}
+	return name
+}
+
+// rewriteProfiles renames the profiles using the rewrite rules.  Profiles
+// that end up with the same name are merged later by combine.
+func rewriteProfiles(profiles []*cover.Profile, rules []Rewrite) {
+	if len(rules) == 0 {
+		return
+	}
+	for _, profile := range profiles {
+		profile.FileName = rewriteName(profile.FileName, rules)
+	}
+}
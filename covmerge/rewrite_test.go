@@ -0,0 +1,57 @@
+package covmerge
+
+import (
+	"testing"
+)
+
+func TestRewriteApply(t *testing.T) {
+	home, err := RegexpRewrite(`^/home/[^/]+/src/`, "")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	rules := []Rewrite{
+		PrefixRewrite("/go/src/", ""),
+		PrefixRewrite("github.com/fork/repo", "github.com/org/repo"),
+		home,
+	}
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"/go/src/github.com/org/repo/a.go", "github.com/org/repo/a.go"},
+		{"/go/src/github.com/fork/repo/a.go", "github.com/org/repo/a.go"},
+		{"github.com/fork/repo/b/b.go", "github.com/org/repo/b/b.go"},
+		{"github.com/fork/repo2/a.go", "github.com/fork/repo2/a.go"},
+		{"/home/ci/src/github.com/fork/repo/a.go", "github.com/fork/repo/a.go"},
+		{"example.com/other/a.go", "example.com/other/a.go"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := rewriteName(tc.name, rules); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRewriteRegexpGroups(t *testing.T) {
+	r, err := RegexpRewrite(`^github\.com/([^/]+)/repo/`, "example.com/${1}/")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if actual := r.Apply("github.com/org/repo/a.go"); actual != "example.com/org/a.go" {
+		t.Errorf("unexpected rewrite %q", actual)
+	}
+	if !r.IsRegexp() || r.String() != `^github\.com/([^/]+)/repo/=example.com/${1}/` {
+		t.Errorf("unexpected rule %s", r)
+	}
+}
+
+func TestRegexpRewriteError(t *testing.T) {
+	if _, err := RegexpRewrite("(", ""); err == nil {
+		t.Error("expected error")
+	}
+}
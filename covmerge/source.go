@@ -0,0 +1,429 @@
+package covmerge
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// mergeBlocks maps the blocks of a profile onto the canonical blocks
+// recomputed from its source file.
+func (r *Resolver) mergeBlocks(profile *cover.Profile) ([]cover.ProfileBlock, error) {
+	path, err := r.Resolve(profile.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	canonical, err := sourceBlocks(path, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapBlocks(profile.Mode, canonical, profile.Blocks), nil
+}
+
+// mapBlocks sets the count of each canonical block from the sorted input
+// blocks overlapping it.  Identical input blocks are merged first, so count
+// mode adds up their executions, otherwise the highest count is kept.
+// Input blocks that no longer match the source are dropped.
+func mapBlocks(mode string, canonical, blocks []cover.ProfileBlock) []cover.ProfileBlock {
+	blocks = collapseIdentical(mode, blocks)
+
+	for i := range canonical {
+		c := &canonical[i]
+		for j := range blocks {
+			b := &blocks[j]
+			if !(position{b.StartLine, b.StartCol}).before(position{c.EndLine, c.EndCol}) {
+				break
+			}
+			if (position{c.StartLine, c.StartCol}).before(position{b.EndLine, b.EndCol}) {
+				c.Count = max(c.Count, b.Count)
+			}
+		}
+	}
+	return canonical
+}
+
+// sourceBlocks computes the statement blocks cmd/cover instruments for a Go
+// source file, returned in source order.
+func sourceBlocks(fileName string, src []byte) ([]cover.ProfileBlock, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	finder := &blockFinder{fset: fset, content: src}
+	ast.Walk(finder, file)
+	if finder.err != nil {
+		return nil, finder.err
+	}
+
+	sort.Sort(orderedBlocks(finder.blocks))
+	return finder.blocks, nil
+}
+
+// blockFinder walks a file's syntax tree recording the basic blocks the
+// same way cmd/cover places its counters.
+type blockFinder struct {
+	fset    *token.FileSet
+	content []byte
+	blocks  []cover.ProfileBlock
+	err     error
+}
+
+// Visit implements the ast.Visitor interface.
+func (f *blockFinder) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		// switch and select bodies are a list of clauses, each clause is a block
+		if len(n.List) > 0 {
+			switch n.List[0].(type) {
+			case *ast.CaseClause:
+				for _, s := range n.List {
+					clause := s.(*ast.CaseClause)
+					f.addBlocks(clause.Colon+1, clause.Colon+1, clause.End(), clause.Body, false)
+				}
+				return f
+			case *ast.CommClause:
+				for _, s := range n.List {
+					clause := s.(*ast.CommClause)
+					f.addBlocks(clause.Colon+1, clause.Colon+1, clause.End(), clause.Body, false)
+				}
+				return f
+			}
+		}
+		f.addBlocks(n.Lbrace, n.Lbrace+1, n.Rbrace+1, n.List, true)
+	case *ast.IfStmt:
+		return f.visitIf(n)
+	case *ast.SelectStmt:
+		if n.Body == nil || len(n.Body.List) == 0 {
+			return nil
+		}
+	case *ast.SwitchStmt:
+		if n.Body == nil || len(n.Body.List) == 0 {
+			if n.Init != nil {
+				ast.Walk(f, n.Init)
+			}
+			if n.Tag != nil {
+				ast.Walk(f, n.Tag)
+			}
+			return nil
+		}
+	case *ast.TypeSwitchStmt:
+		if n.Body == nil || len(n.Body.List) == 0 {
+			if n.Init != nil {
+				ast.Walk(f, n.Init)
+			}
+			ast.Walk(f, n.Assign)
+			return nil
+		}
+	case *ast.FuncDecl:
+		// blank and bodyless functions are never executed
+		if n.Name.Name == "_" || n.Body == nil {
+			return nil
+		}
+	}
+	return f
+}
+
+// visitIf walks an if statement.  cmd/cover wraps an else clause in a hidden
+// block starting just after the else keyword so an else if has its own counter.
+func (f *blockFinder) visitIf(n *ast.IfStmt) ast.Visitor {
+	if n.Init != nil {
+		ast.Walk(f, n.Init)
+	}
+	ast.Walk(f, n.Cond)
+	ast.Walk(f, n.Body)
+	if n.Else == nil {
+		return nil
+	}
+
+	elseOffset := findText(f.content, f.offset(n.Body.End()), "else")
+	if elseOffset < 0 {
+		f.err = fmt.Errorf("%s: lost else", f.fset.Position(n.Body.End()))
+		return nil
+	}
+
+	pos := f.fset.File(n.Body.End()).Pos(elseOffset + len("else"))
+	switch stmt := n.Else.(type) {
+	case *ast.IfStmt:
+		ast.Walk(f, &ast.BlockStmt{Lbrace: pos, List: []ast.Stmt{stmt}, Rbrace: stmt.End()})
+	case *ast.BlockStmt:
+		stmt.Lbrace = pos
+		ast.Walk(f, stmt)
+	}
+	return nil
+}
+
+// addBlocks records the basic blocks at the top level of a statement list.
+// An empty list still gets a block, starting from insertPos.
+func (f *blockFinder) addBlocks(pos, insertPos, blockEnd token.Pos, list []ast.Stmt, extendToClosingBrace bool) {
+	if len(list) == 0 {
+		r := f.codeRanges(insertPos, blockEnd)[0]
+		f.addBlock(r.pos, r.end, 0)
+		return
+	}
+
+	list = append([]ast.Stmt(nil), list...)
+	for {
+		// the first statement changing the flow of control ends the basic block
+		var last int
+		end := blockEnd
+		for last = 0; last < len(list); last++ {
+			stmt := list[last]
+			end = statementBoundary(stmt)
+			if endsBasicSourceBlock(stmt) {
+				// a label may be the target of a goto, so it starts a new block
+				if label, isLabel := stmt.(*ast.LabeledStmt); isLabel && !isControl(label.Stmt) {
+					newLabel := *label
+					newLabel.Stmt = &ast.EmptyStmt{Semicolon: label.Stmt.Pos(), Implicit: true}
+					end = label.Pos()
+					list[last] = &newLabel
+					list = append(list, nil)
+					copy(list[last+1:], list[last:])
+					list[last+1] = label.Stmt
+				}
+				last++
+				extendToClosingBrace = false
+				break
+			}
+		}
+		if extendToClosingBrace {
+			end = blockEnd
+		}
+		if pos != end {
+			// only the lines holding code are covered, each run of them
+			// getting its own block unless it starts inside a statement
+			for _, r := range mergeWithinStatements(f.codeRanges(pos, end), list[:last]) {
+				f.addBlock(r.pos, r.end, last)
+			}
+		}
+		list = list[last:]
+		if len(list) == 0 {
+			break
+		}
+		pos = list[0].Pos()
+	}
+}
+
+// codeRange is a run of source lines holding executable code.
+type codeRange struct {
+	pos, end token.Pos
+}
+
+// codeRanges splits the source between start and end into the runs of lines
+// holding code, skipping blank and comment lines and lines holding only
+// braces.  A run starts at its first token and ends at the start of the line
+// after its last code line.  When there is no code a single empty range at
+// start is returned.
+func (f *blockFinder) codeRanges(start, end token.Pos) []codeRange {
+	startOffset := f.offset(start)
+	src := f.content[startOffset:f.offset(end)]
+	file := f.fset.File(start)
+
+	// scan the section on its own so line numbers are relative to start
+	scanFile := token.NewFileSet().AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(scanFile, src, nil, 0)
+
+	toFile := func(pos token.Pos) token.Pos { return file.Pos(startOffset + scanFile.Offset(pos)) }
+	nextLine := func(line int) token.Pos { return toFile(scanFile.LineStart(line + 1)) }
+
+	var ranges []codeRange
+	var codeStart token.Pos
+	lastLine := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if !isCodeToken(tok, lit) {
+			continue
+		}
+
+		line := scanFile.PositionFor(pos, false).Line
+		endLine := line
+		if tok == token.STRING {
+			endLine = scanFile.PositionFor(pos+token.Pos(len(lit)), false).Line
+		}
+
+		switch {
+		case lastLine == 0:
+			codeStart = toFile(pos)
+		case line > lastLine+1:
+			ranges = append(ranges, codeRange{codeStart, nextLine(lastLine)})
+			codeStart = toFile(pos)
+		}
+		lastLine = max(lastLine, endLine)
+	}
+
+	switch {
+	case lastLine == 0:
+		return []codeRange{{start, start}}
+	case lastLine < scanFile.LineCount():
+		return append(ranges, codeRange{codeStart, nextLine(lastLine)})
+	}
+	return append(ranges, codeRange{codeStart, end})
+}
+
+// isCodeToken reports whether a token is code rather than a brace or an
+// automatically inserted semicolon.
+func isCodeToken(tok token.Token, lit string) bool {
+	switch tok {
+	case token.LBRACE, token.RBRACE:
+		return false
+	case token.SEMICOLON:
+		return lit != "\n"
+	}
+	return true
+}
+
+// mergeWithinStatements joins each range starting inside one of the sorted
+// statements onto the range before it, so a statement spanning blank or
+// comment lines stays in one block.
+func mergeWithinStatements(ranges []codeRange, stmts []ast.Stmt) []codeRange {
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		i := sort.Search(len(stmts), func(i int) bool { return stmts[i].Pos() >= r.pos })
+		if i > 0 && r.pos < stmts[i-1].End() {
+			merged[len(merged)-1].end = r.end
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (f *blockFinder) addBlock(start, end token.Pos, numStmt int) {
+	s := f.fset.PositionFor(start, false)
+	e := f.fset.PositionFor(end, false)
+	f.blocks = append(f.blocks, cover.ProfileBlock{
+		StartLine: s.Line,
+		StartCol:  s.Column,
+		EndLine:   e.Line,
+		EndCol:    e.Column,
+		NumStmt:   numStmt,
+	})
+}
+
+func (f *blockFinder) offset(pos token.Pos) int {
+	return f.fset.PositionFor(pos, false).Offset
+}
+
+// findText returns the offset of text in src at or after start, skipping comments.
+func findText(src []byte, start int, text string) int {
+	b := []byte(text)
+	for i := start; i < len(src); {
+		switch {
+		case bytes.HasPrefix(src[i:], b):
+			return i
+		case bytes.HasPrefix(src[i:], []byte("//")):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return -1
+			}
+			i += end + 4
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// statementBoundary finds the position in s that terminates the current basic block.
+func statementBoundary(s ast.Stmt) token.Pos {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		return s.Lbrace
+	case *ast.IfStmt:
+		return firstFuncLiteral(s.Body.Lbrace, s.Init, s.Cond)
+	case *ast.ForStmt:
+		return firstFuncLiteral(s.Body.Lbrace, s.Init, s.Cond, s.Post)
+	case *ast.LabeledStmt:
+		return statementBoundary(s.Stmt)
+	case *ast.RangeStmt:
+		return firstFuncLiteral(s.Body.Lbrace, s.X)
+	case *ast.SwitchStmt:
+		return firstFuncLiteral(s.Body.Lbrace, s.Init, s.Tag)
+	case *ast.SelectStmt:
+		return s.Body.Lbrace
+	case *ast.TypeSwitchStmt:
+		return firstFuncLiteral(s.Body.Lbrace, s.Init)
+	}
+	// a function literal body is a block of its own, so the block stops at its start
+	return firstFuncLiteral(s.End(), s)
+}
+
+// firstFuncLiteral returns the body start of the first function literal in
+// nodes, or otherwise.
+func firstFuncLiteral(otherwise token.Pos, nodes ...ast.Node) token.Pos {
+	for _, n := range nodes {
+		if found, pos := hasFuncLiteral(n); found {
+			return pos
+		}
+	}
+	return otherwise
+}
+
+// endsBasicSourceBlock reports whether s changes the flow of control or contains a function literal.
+func endsBasicSourceBlock(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.BlockStmt, *ast.BranchStmt, *ast.ForStmt, *ast.IfStmt, *ast.LabeledStmt,
+		*ast.RangeStmt, *ast.SwitchStmt, *ast.SelectStmt, *ast.TypeSwitchStmt:
+		return true
+	case *ast.ExprStmt:
+		// calls to panic change the flow
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" && len(call.Args) == 1 {
+				return true
+			}
+		}
+	}
+	found, _ := hasFuncLiteral(s)
+	return found
+}
+
+// isControl reports whether s is a control statement that cannot be separated from its label.
+func isControl(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.SelectStmt, *ast.TypeSwitchStmt:
+		return true
+	}
+	return false
+}
+
+// hasFuncLiteral reports whether n contains a function literal and the start of its body.
+func hasFuncLiteral(n ast.Node) (bool, token.Pos) {
+	if n == nil {
+		return false, token.NoPos
+	}
+	var pos token.Pos
+	ast.Inspect(n, func(node ast.Node) bool {
+		if pos != token.NoPos {
+			return false
+		}
+		if lit, ok := node.(*ast.FuncLit); ok {
+			pos = lit.Body.Lbrace
+			return false
+		}
+		return true
+	})
+	return pos != token.NoPos, pos
+}
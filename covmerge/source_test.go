@@ -0,0 +1,230 @@
+package covmerge
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestSourceBlocks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected []cover.ProfileBlock
+	}{
+		{
+			name: "branches",
+			src: `package p
+
+func f(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < -10 {
+		return -1
+	}
+	return 0
+}
+
+func _() {
+	panic("never")
+}
+`,
+			expected: []cover.ProfileBlock{
+				{StartLine: 4, StartCol: 2, EndLine: 4, EndCol: 11, NumStmt: 1},
+				{StartLine: 5, StartCol: 3, EndLine: 6, EndCol: 1, NumStmt: 1},
+				{StartLine: 6, StartCol: 9, EndLine: 6, EndCol: 20, NumStmt: 1},
+				{StartLine: 7, StartCol: 3, EndLine: 8, EndCol: 1, NumStmt: 1},
+				{StartLine: 9, StartCol: 2, EndLine: 9, EndCol: 10, NumStmt: 1},
+			},
+		},
+		{
+			name: "code lines",
+			src: `package p
+
+func g() int {
+	a := 1
+
+	// comment
+	b := a
+	c := b +
+		// inside
+		1
+	return c
+}
+
+func e() {}
+
+func s(x int) {
+	switch x {
+	case 1:
+	}
+}
+`,
+			expected: []cover.ProfileBlock{
+				{StartLine: 4, StartCol: 2, EndLine: 5, EndCol: 1, NumStmt: 4},
+				{StartLine: 7, StartCol: 2, EndLine: 12, EndCol: 1, NumStmt: 4},
+				{StartLine: 14, StartCol: 11, EndLine: 14, EndCol: 11, NumStmt: 0},
+				{StartLine: 17, StartCol: 2, EndLine: 17, EndCol: 11, NumStmt: 1},
+				{StartLine: 18, StartCol: 9, EndLine: 18, EndCol: 9, NumStmt: 0},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := sourceBlocks("p.go", []byte(tc.src))
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSourceBlocksMatchGoTest(t *testing.T) {
+	// sample.out is the profile go test -coverprofile writes for the module,
+	// less its generated file.
+	profiles, err := LoadProfiles("testdata/module/sample.out")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	src, err := os.ReadFile("testdata/module/sample.go")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	actual, err := sourceBlocks("sample.go", src)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := profiles[0].Blocks
+	for i := range expected {
+		expected[i].Count = 0
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSourceBlocksParseError(t *testing.T) {
+	if _, err := sourceBlocks("bad.go", []byte("package")); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestFindText(t *testing.T) {
+	src := []byte("} /* else */ // else\n else {")
+	if i := findText(src, 0, "else"); i != 22 {
+		t.Errorf("expected 22, got %d", i)
+	}
+	if i := findText(src, 0, "then"); i != -1 {
+		t.Errorf("expected -1, got %d", i)
+	}
+}
+
+func TestMapBlocks(t *testing.T) {
+	canonical := []cover.ProfileBlock{
+		{StartLine: 1, StartCol: 10, EndLine: 2, EndCol: 5, NumStmt: 2},
+		{StartLine: 2, StartCol: 5, EndLine: 4, EndCol: 3, NumStmt: 1},
+		{StartLine: 5, StartCol: 2, EndLine: 5, EndCol: 9, NumStmt: 1},
+	}
+	blocks := []cover.ProfileBlock{
+		{StartLine: 1, StartCol: 10, EndLine: 2, EndCol: 5, NumStmt: 2, Count: 2},
+		{StartLine: 1, StartCol: 10, EndLine: 2, EndCol: 5, NumStmt: 2, Count: 3},
+		{StartLine: 3, StartCol: 2, EndLine: 4, EndCol: 1, NumStmt: 1, Count: 4},
+		{StartLine: 9, StartCol: 2, EndLine: 9, EndCol: 9, NumStmt: 1, Count: 9},
+	}
+
+	expected := []cover.ProfileBlock{
+		{StartLine: 1, StartCol: 10, EndLine: 2, EndCol: 5, NumStmt: 2, Count: 5},
+		{StartLine: 2, StartCol: 5, EndLine: 4, EndCol: 3, NumStmt: 1, Count: 4},
+		{StartLine: 5, StartCol: 2, EndLine: 5, EndCol: 9, NumStmt: 1, Count: 0},
+	}
+
+	actual := mapBlocks(ModeCount, canonical, blocks)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestMergeSource(t *testing.T) {
+	m, err := addFiles(Options{Strategy: StrategySource, Src: "testdata/module"}, "testdata/module/sample.out")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	merged, err := m.Merge()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(merged) != 1 {
+		t.Fatal("len wrong", len(merged))
+	}
+
+	blocks := merged[0].Blocks
+	if len(blocks) != 27 {
+		t.Errorf("expected 27 blocks, got %d", len(blocks))
+	}
+
+	total, covered := 0, 0
+	for _, b := range blocks {
+		total += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+	}
+	if total != 31 || covered != 25 {
+		t.Errorf("expected 25 of 31 statements, got %d of %d", covered, total)
+	}
+
+	first := cover.ProfileBlock{StartLine: 8, StartCol: 2, EndLine: 8, EndCol: 11, NumStmt: 1, Count: 1}
+	if blocks[0] != first {
+		t.Errorf("expected %v, got %v", first, blocks[0])
+	}
+}
+
+func TestMergeSourceMissing(t *testing.T) {
+	for _, maxBlocks := range []int{0, 1} {
+		var warnings []error
+		m, err := addFiles(Options{
+			Strategy:  StrategySource,
+			Src:       "testdata/module",
+			MaxBlocks: maxBlocks,
+			Warn:      func(err error) { warnings = append(warnings, err) },
+		}, "testdata/cover_1.out", "testdata/module/sample.out")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		merged, err := m.Merge()
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		expected := "github.com/repo/gocovdedup/main.go: source not found in module example.com/sample"
+		if len(warnings) != 1 || warnings[0].Error() != expected {
+			t.Errorf("expected warning %s, got %v", expected, warnings)
+		}
+
+		// the missing file falls back to the union strategy
+		union, err := LoadProfiles("testdata/cover_1.out")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		union[0].Blocks = unionBlocks(union[0].Mode, union[0].Blocks)
+		if len(merged) != 2 {
+			t.Fatal("len wrong", len(merged))
+		}
+		if len(merged[0].Blocks) != 27 {
+			t.Errorf("expected 27 source blocks, got %d", len(merged[0].Blocks))
+		}
+		if !reflect.DeepEqual(merged[1].Blocks, union[0].Blocks) {
+			t.Errorf("expected %v, got %v", union[0].Blocks, merged[1].Blocks)
+		}
+	}
+}
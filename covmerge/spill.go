@@ -0,0 +1,560 @@
+package covmerge
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// record is a block read from an input, kept with the index of the input so
+// the blocks an input repeats can be combined as loading it would have.  An
+// input index below zero marks a file that was added without blocks.
+type record struct {
+	file  string
+	input int
+	block cover.ProfileBlock
+}
+
+// recordLess orders records by file name, input and block position.
+func recordLess(r1, r2 *record) bool {
+	if r1.file != r2.file {
+		return r1.file < r2.file
+	}
+	if r1.input != r2.input {
+		return r1.input < r2.input
+	}
+	return blockLess(&r1.block, &r2.block)
+}
+
+func sortRecords(records []record) {
+	sort.Slice(records, func(i, j int) bool { return recordLess(&records[i], &records[j]) })
+}
+
+// writeRecord writes a record as its input index followed by a go cover
+// profile line.
+func writeRecord(w io.Writer, r *record) error {
+	b := &r.block
+	_, err := fmt.Fprintf(w, "%d %s:%d.%d,%d.%d %d %d\n", r.input, r.file, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+	return err
+}
+
+// parseRecord parses a line written by writeRecord.
+func parseRecord(line string) (record, error) {
+	input, rest, found := strings.Cut(line, " ")
+	if !found {
+		return record{}, fmt.Errorf("bad spilled record %q", line)
+	}
+
+	var r record
+	var err error
+	if r.input, err = strconv.Atoi(input); err != nil {
+		return record{}, fmt.Errorf("bad spilled record %q", line)
+	}
+	if r.file, r.block, err = parseCoverLine(rest); err != nil {
+		return record{}, fmt.Errorf("bad spilled record %q: %w", line, err)
+	}
+	return r, nil
+}
+
+// runFanIn is the number of run files of one size that are merged into a
+// single larger run, bounding the files open when merging.
+const runFanIn = 16
+
+// spiller holds records in memory up to a limit, beyond which they are
+// sorted and written to a temporary run file.  The runs are merged back in
+// order, so the records of one file at a time are all that is held in
+// memory.
+type spiller struct {
+	dir   string
+	limit int
+	names map[string]string
+	buf   []record
+	runs  []runFile
+}
+
+// runFile is a spilled run, its level the number of times its records have
+// been merged into a larger run.
+type runFile struct {
+	name  string
+	level int
+}
+
+func newSpiller(dir string, limit int) *spiller {
+	return &spiller{dir: dir, limit: limit, names: make(map[string]string)}
+}
+
+// add adds a record, spilling the held records once the limit is reached.
+func (s *spiller) add(r record) error {
+	// share one copy of each file name between the held records
+	if name, found := s.names[r.file]; found {
+		r.file = name
+	} else {
+		s.names[r.file] = r.file
+	}
+
+	s.buf = append(s.buf, r)
+	if len(s.buf) >= s.limit {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill sorts the held records and writes them to a new run file, merging
+// runs of the same level once there are runFanIn of them.
+func (s *spiller) spill() error {
+	sortRecords(s.buf)
+	name, err := s.writeRun(&memoryRun{records: s.buf})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, runFile{name: name})
+	s.buf = s.buf[:0]
+	s.names = make(map[string]string)
+
+	for level := 0; s.count(level) == runFanIn; level++ {
+		if err := s.compact(level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count returns the number of runs at level.
+func (s *spiller) count(level int) int {
+	n := 0
+	for _, r := range s.runs {
+		if r.level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// compact merges the runs at level into one run at the next level.
+func (s *spiller) compact(level int) error {
+	var names []string
+	kept := s.runs[:0]
+	for _, r := range s.runs {
+		if r.level == level {
+			names = append(names, r.name)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+
+	runs, closeRuns, err := openRuns(names, nil)
+	if err != nil {
+		return err
+	}
+	name, err := s.writeRun(runs)
+	closeRuns()
+	if err != nil {
+		return err
+	}
+
+	for _, old := range names {
+		os.Remove(old)
+	}
+	s.runs = append(kept, runFile{name: name, level: level + 1})
+	return nil
+}
+
+// writeRun writes the records of r to a new run file, returning its name.
+func (s *spiller) writeRun(r run) (string, error) {
+	f, err := os.CreateTemp(s.dir, "gocovdedup-run-*")
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(f)
+	err = writeRecords(w, r)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("spilling blocks: %w", err)
+	}
+	return f.Name(), nil
+}
+
+func writeRecords(w io.Writer, r run) error {
+	for {
+		next, more, err := r.next()
+		if err != nil || !more {
+			return err
+		}
+		if err := writeRecord(w, &next); err != nil {
+			return err
+		}
+	}
+}
+
+// merge passes the records of each file to fn in file name order, the
+// records sorted by input and block position.  The records slice is reused
+// between calls.  The run files are removed and the spiller emptied.
+func (s *spiller) merge(fn func(file string, records []record) error) error {
+	defer s.reset()
+
+	sortRecords(s.buf)
+	names := make([]string, len(s.runs))
+	for i, r := range s.runs {
+		names[i] = r.name
+	}
+	runs, closeRuns, err := openRuns(names, s.buf)
+	if err != nil {
+		return err
+	}
+	defer closeRuns()
+
+	var group []record
+	for {
+		next, more, err := runs.next()
+		if err != nil {
+			return err
+		}
+		if len(group) > 0 && (!more || group[0].file != next.file) {
+			if err := fn(group[0].file, group); err != nil {
+				return err
+			}
+			group = group[:0]
+		}
+		if !more {
+			return nil
+		}
+		group = append(group, next)
+	}
+}
+
+// reset removes the run files and drops the held records.
+func (s *spiller) reset() {
+	for _, r := range s.runs {
+		os.Remove(r.name)
+	}
+	s.runs = nil
+	s.buf = nil
+	s.names = make(map[string]string)
+}
+
+// openRuns opens the run files, along with the sorted records held in
+// memory, as a single run.  The returned func closes the files.
+func openRuns(names []string, records []record) (*runHeap, func(), error) {
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	runs := &runHeap{}
+	if err := runs.push(&memoryRun{records: records}); err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		if err := runs.push(&fileRun{scanner: bufio.NewScanner(f)}); err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+	}
+	return runs, closeFiles, nil
+}
+
+// run is a sorted sequence of records.
+type run interface {
+	// next returns the next record, false at the end of the run.
+	next() (record, bool, error)
+}
+
+// memoryRun is the run of the records still held in memory.
+type memoryRun struct {
+	records []record
+}
+
+func (r *memoryRun) next() (record, bool, error) {
+	if len(r.records) == 0 {
+		return record{}, false, nil
+	}
+	next := r.records[0]
+	r.records = r.records[1:]
+	return next, true, nil
+}
+
+// fileRun reads a run file written by spill.
+type fileRun struct {
+	scanner *bufio.Scanner
+}
+
+func (r *fileRun) next() (record, bool, error) {
+	if !r.scanner.Scan() {
+		return record{}, false, r.scanner.Err()
+	}
+	next, err := parseRecord(r.scanner.Text())
+	return next, err == nil, err
+}
+
+// runHead is a run with its current record.
+type runHead struct {
+	run     run
+	current record
+}
+
+func (h *runHead) next() (bool, error) {
+	var more bool
+	var err error
+	h.current, more, err = h.run.next()
+	return more, err
+}
+
+// runHeap orders the runs by their current record, implementing heap.Interface.
+type runHeap []*runHead
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return recordLess(&h[i].current, &h[j].current) }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runHead)) }
+
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// next removes and returns the least current record of the runs, false once
+// every run is exhausted, so a runHeap is itself a run.
+func (h *runHeap) next() (record, bool, error) {
+	if h.Len() == 0 {
+		return record{}, false, nil
+	}
+
+	head := (*h)[0]
+	next := head.current
+	more, err := head.next()
+	if err != nil {
+		return record{}, false, err
+	}
+	if more {
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
+	}
+	return next, true, nil
+}
+
+// push adds a run to the heap unless it is empty.
+func (h *runHeap) push(r run) error {
+	head := &runHead{run: r}
+	more, err := head.next()
+	if err != nil || !more {
+		return err
+	}
+	heap.Push(h, head)
+	return nil
+}
+
+// source is an input whose blocks were spilled.  A go cover profile is
+// spilled as it is read, so the identical blocks it repeats are combined in
+// its own cover mode when merged back, as parsing it would have, before the
+// counts are converted to the merged mode.
+type source struct {
+	name     string
+	mode     string
+	collapse bool
+}
+
+// blocks combines and converts the sorted blocks spilled from the source for
+// a single file.
+func (s *source) blocks(records []record, mode string) ([]cover.ProfileBlock, error) {
+	blocks := make([]cover.ProfileBlock, 0, len(records))
+	for i := range records {
+		block := records[i].block
+		if n := len(blocks); s.collapse && n > 0 && sameRange(&blocks[n-1], &block) {
+			last := &blocks[n-1]
+			if block.NumStmt != last.NumStmt {
+				return nil, fmt.Errorf("%s: inconsistent NumStmt: changed from %d to %d", s.name, last.NumStmt, block.NumStmt)
+			}
+			if s.mode == ModeSet {
+				last.Count |= block.Count
+			} else {
+				last.Count += block.Count
+			}
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	for i := range blocks {
+		blocks[i].Count = convertCount(s.mode, mode, blocks[i].Count)
+	}
+	return blocks, nil
+}
+
+// startSpilling prepares the Merger to spill blocks.  The files are
+// filtered as their blocks are added rather than when merging.
+func (m *Merger) startSpilling() error {
+	var generated *Resolver
+	if m.opts.SkipGenerated {
+		generated = m.resolver
+	}
+	filter, err := newFileFilter(m.opts.Include, m.opts.IncludeFiles, m.opts.IgnoreFiles, m.includeModule(), generated)
+	if err != nil {
+		return err
+	}
+
+	m.filter = filter
+	m.spill = newSpiller(m.opts.TempDir, m.opts.MaxBlocks)
+	return nil
+}
+
+// spillProfiles spills the blocks of profiles that have already been read.
+func (m *Merger) spillProfiles(name string, profiles []*cover.Profile) error {
+	if err := m.modes.reconcile(name, profiles); err != nil {
+		return err
+	}
+	rewriteProfiles(profiles, m.opts.Rewrites)
+
+	// LCOV profiles keep their mode until merged
+	mode := m.modes.merged()
+	if len(profiles) > 0 {
+		mode = profiles[0].Mode
+	}
+
+	input := len(m.sources)
+	m.sources = append(m.sources, source{name: name, mode: mode})
+	for _, profile := range profiles {
+		// keep files without blocks, as combining the profiles would
+		if len(profile.Blocks) == 0 {
+			if err := m.spillBlock(-1, profile.FileName, cover.ProfileBlock{}); err != nil {
+				return err
+			}
+		}
+		for _, block := range profile.Blocks {
+			if err := m.spillBlock(input, profile.FileName, block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spillReader spills the blocks of the profile data read from r.
+func (m *Merger) spillReader(name string, r io.Reader) error {
+	input := len(m.sources)
+	m.sources = append(m.sources, source{name: name})
+	src := &m.sources[input]
+
+	br := bufio.NewReader(r)
+	lcov := isLCOV(br)
+
+	var fileName, rewritten string
+	_, err := scanProfiles(br, func(blockFile, mode string, block cover.ProfileBlock) error {
+		if src.mode == "" {
+			if lcov {
+				m.modes.adapt()
+			} else if _, err := m.modes.modeFor(name, mode); err != nil {
+				return err
+			}
+			src.mode = mode
+		}
+		if blockFile != fileName {
+			fileName, rewritten = blockFile, rewriteName(blockFile, m.opts.Rewrites)
+		}
+		return m.spillBlock(input, rewritten, block)
+	})
+	src.collapse = !lcov
+	return err
+}
+
+// spillFile spills the blocks of a profile file or binary coverage directory.
+func (m *Merger) spillFile(path string) error {
+	file := path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		decoded, err := decodeCoverDir(path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(decoded)
+		file = decoded
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return m.spillReader(path, f)
+}
+
+// spillBlock spills a block unless its file is filtered out.
+func (m *Merger) spillBlock(input int, fileName string, block cover.ProfileBlock) error {
+	keep, warning := m.filter.keep(fileName)
+	if warning != nil {
+		m.warn([]error{warning})
+	}
+	if !keep {
+		return nil
+	}
+	return m.spill.add(record{file: fileName, input: input, block: block})
+}
+
+// mergeSpilled merges the spilled blocks a file at a time.
+func (m *Merger) mergeSpilled(fn func(profile *cover.Profile) error) error {
+	defer func() { m.sources = nil }()
+	if err := m.filter.check(); err != nil {
+		m.spill.reset()
+		return err
+	}
+
+	return m.spill.merge(func(fileName string, records []record) error {
+		profile, err := m.mergeRecords(fileName, records)
+		if err != nil {
+			return err
+		}
+		if m.opts.Directives {
+			m.warn(applyDirectives([]*cover.Profile{profile}, m.resolver))
+		}
+		return fn(profile)
+	})
+}
+
+// mergeRecords merges the records of a single file, sorted by input.
+func (m *Merger) mergeRecords(fileName string, records []record) (*cover.Profile, error) {
+	profile := &cover.Profile{FileName: fileName, Mode: m.modes.merged()}
+	for len(records) > 0 {
+		n := 1
+		for n < len(records) && records[n].input == records[0].input {
+			n++
+		}
+		if input := records[0].input; input >= 0 {
+			blocks, err := m.sources[input].blocks(records[:n], profile.Mode)
+			if err != nil {
+				return nil, err
+			}
+			profile.Blocks = append(profile.Blocks, blocks...)
+		}
+		records = records[n:]
+	}
+
+	if err := mergeFile(profile, m.merge); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
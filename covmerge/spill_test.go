@@ -0,0 +1,220 @@
+package covmerge
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestSpilledMergeMatchesMemory(t *testing.T) {
+	ignore := filepath.Join(t.TempDir(), ".covignore")
+	writeFile(t, ignore, "**/cmd/**\n")
+
+	testCases := []struct {
+		name  string
+		opts  Options
+		files []string
+	}{
+		{"union", Options{}, []string{"testdata/cover_1.out", "testdata/cover_2.out", "testdata/cover_multi.out"}},
+		{"split", Options{Strategy: StrategySplit}, []string{"testdata/cover_1.out", "testdata/cover_2.out", "testdata/cover_multi.out"}},
+		{"count", Options{Mode: ModeCount}, []string{"testdata/cover_count.out", "testdata/cover_count.out", "testdata/cover_1.out"}},
+		{"set", Options{Mode: ModeSet}, []string{"testdata/cover_count.out", "testdata/cover_2.out"}},
+		{"lcov", Options{Mode: ModeCount}, []string{"testdata/cover.info", "testdata/cover_2.out"}},
+		{"lcov mode", Options{}, []string{"testdata/cover.info", "testdata/cover_2.out"}},
+		{"covdata", Options{}, []string{"testdata/covdata", "testdata/module/sample.out"}},
+		{"filters", Options{
+			Src:           "testdata/module",
+			Include:       []string{"example.com/sample/..."},
+			IgnoreFiles:   []string{ignore},
+			SkipGenerated: true,
+			Directives:    true,
+			Rewrites:      []Rewrite{PrefixRewrite("github.com/repo/gocovdedup", "example.com/sample")},
+		}, []string{"testdata/module/sample.out", "testdata/cover_2.out"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := addFiles(tc.opts, tc.files...)
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			expected, err := m.Merge()
+			if err != nil || len(expected) == 0 {
+				t.Fatal("unexpected merge", expected, err)
+			}
+
+			for _, maxBlocks := range []int{1, 2, 1000} {
+				opts := tc.opts
+				opts.MaxBlocks = maxBlocks
+				opts.TempDir = t.TempDir()
+
+				m, err := addFiles(opts, tc.files...)
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+				merged, err := m.Merge()
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+				if !reflect.DeepEqual(merged, expected) {
+					t.Errorf("max blocks %d: expected %v, got %v", maxBlocks, expected, merged)
+				}
+				assertEmptyDir(t, opts.TempDir)
+			}
+		})
+	}
+}
+
+func TestSpilledAddReader(t *testing.T) {
+	data := "mode: set\na.go:1.1,2.1 1 0\nb.go:1.1,2.1 1 1\na.go:1.1,2.1 1 1\n"
+	profiles := []*cover.Profile{
+		{FileName: "c.go", Mode: ModeSet},
+		{FileName: "b.go", Mode: ModeSet, Blocks: []cover.ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 1, NumStmt: 1}}},
+	}
+
+	m, err := New(Options{MaxBlocks: 2, TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if err := m.AddReader("stdin", strings.NewReader(data)); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if err := m.Add("profiles", profiles); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var names []string
+	err = m.MergeEach(func(profile *cover.Profile) error {
+		if profile.Mode != ModeSet {
+			t.Errorf("unexpected mode %s", profile.Mode)
+		}
+		if profile.FileName != "c.go" && (len(profile.Blocks) != 1 || profile.Blocks[0].Count != 1) {
+			t.Errorf("unexpected blocks %s %v", profile.FileName, profile.Blocks)
+		}
+		names = append(names, profile.FileName)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"a.go", "b.go", "c.go"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestSpilledErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     []string
+		expected string
+	}{
+		{"numstmt", []string{"mode: set\na.go:1.1,2.1 1 0\na.go:1.1,2.1 2 1\n"}, "in0: inconsistent NumStmt: changed from 1 to 2"},
+		{"mode", []string{"mode: set\na.go:1.1,2.1 1 0\n", "mode: count\na.go:1.1,2.1 1 0\n"}, `in1: cover mode "count" conflicts with mode "set" from in0, use -mode to convert`},
+		{"parse", []string{"mode: set\na.go:1.1,2.1 1\n"}, `line "a.go:1.1,2.1 1" doesn't match expected format: couldn't find a NumStmt`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m, err := New(Options{MaxBlocks: 1, TempDir: dir})
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+
+			for i, data := range tc.data {
+				if err = m.AddReader("in"+strconv.Itoa(i), strings.NewReader(data)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				_, err = m.Merge()
+			}
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected %s, got %v", tc.expected, err)
+			}
+
+			m.Close()
+			assertEmptyDir(t, dir)
+		})
+	}
+}
+
+func TestSpillerCompacts(t *testing.T) {
+	s := newSpiller(t.TempDir(), 1)
+	defer s.reset()
+
+	n := runFanIn*runFanIn + 1
+	for i := n; i > 0; i-- {
+		if err := s.add(record{file: "a.go", block: cover.ProfileBlock{StartLine: i, NumStmt: 1}}); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	if len(s.runs) != 2 || s.runs[0].level != 2 || s.runs[1].level != 0 {
+		t.Errorf("unexpected runs %v", s.runs)
+	}
+
+	var records []record
+	err := s.merge(func(file string, group []record) error {
+		records = append(records, group...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(records) != n {
+		t.Fatalf("expected %d records, got %d", n, len(records))
+	}
+	for i, r := range records {
+		if r.block.StartLine != i+1 {
+			t.Fatalf("record %d out of order: %v", i, r)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	testCases := []struct {
+		name    string
+		line    string
+		isValid bool
+	}{
+		{"valid", "-1 example.com/a b.go:1.2,3.4 5 6", true},
+		{"no input", "example.com/a.go:1.2,3.4", false},
+		{"bad input", "x example.com/a.go:1.2,3.4 5 6", false},
+		{"bad block", "0 example.com/a.go:1.2,3.4 5", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseRecord(tc.line)
+			if (err == nil) != tc.isValid {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !tc.isValid {
+				return
+			}
+
+			var buf strings.Builder
+			if err := writeRecord(&buf, &r); err != nil || buf.String() != tc.line+"\n" {
+				t.Errorf("expected %s, got %s %v", tc.line, buf.String(), err)
+			}
+		})
+	}
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected spilled blocks removed, found %v", entries)
+	}
+}
@@ -0,0 +1,149 @@
+package covmerge
+
+import (
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// position is a line and column location within a source file.
+type position struct {
+	line, col int
+}
+
+func (p position) before(o position) bool {
+	return p.line < o.line || (p.line == o.line && p.col < o.col)
+}
+
+// fragment is a disjoint section of source covered by one or more blocks.
+type fragment struct {
+	start, end position
+	owners     []int
+	numStmt    int
+	count      int
+}
+
+// splitBlocks merges sorted blocks by splitting overlapping ranges into
+// disjoint fragments.  A fragment takes the merged count of the blocks
+// covering it.  Each block's statements are kept together on one of its
+// fragments, the one shared with the fewest other blocks, so the merged
+// statement total is the total of the blocks and a block's statements are
+// only counted as covered when its own range was reached.  Adjacent fragments
+// covered by the same blocks are joined back together, so blocks that do not
+// overlap anything pass through unchanged.
+func splitBlocks(mode string, blocks []cover.ProfileBlock) []cover.ProfileBlock {
+	blocks = collapseIdentical(mode, blocks)
+
+	fragments := newFragments(blocks)
+
+	covering := make([][]fragment, len(blocks))
+	for i := range blocks {
+		block := &blocks[i]
+		start := sort.Search(len(fragments), func(j int) bool {
+			return !fragments[j].start.before(position{block.StartLine, block.StartCol})
+		})
+		end := start
+		for end < len(fragments) && fragments[end].start.before(position{block.EndLine, block.EndCol}) {
+			end++
+		}
+
+		covering[i] = fragments[start:end]
+		for j := range covering[i] {
+			f := &covering[i][j]
+			if len(f.owners) == 0 {
+				f.count = block.Count
+			} else {
+				f.count = mergeCount(mode, f.count, block.Count)
+			}
+			f.owners = append(f.owners, i)
+		}
+	}
+
+	for i := range blocks {
+		if f := leastShared(covering[i]); f != nil {
+			f.numStmt += blocks[i].NumStmt
+		}
+	}
+
+	return joinFragments(fragments)
+}
+
+// newFragments cuts the source range covered by blocks at every block boundary.
+func newFragments(blocks []cover.ProfileBlock) []fragment {
+	seen := make(map[position]bool, len(blocks)*2)
+	boundaries := make([]position, 0, len(blocks)*2)
+	for _, block := range blocks {
+		for _, p := range []position{{block.StartLine, block.StartCol}, {block.EndLine, block.EndCol}} {
+			if !seen[p] {
+				seen[p] = true
+				boundaries = append(boundaries, p)
+			}
+		}
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].before(boundaries[j]) })
+
+	fragments := make([]fragment, 0, len(boundaries))
+	for i := 1; i < len(boundaries); i++ {
+		fragments = append(fragments, fragment{start: boundaries[i-1], end: boundaries[i]})
+	}
+
+	return fragments
+}
+
+// leastShared returns the first of the fragments covered by the fewest
+// blocks, or nil when there are none.
+func leastShared(fragments []fragment) *fragment {
+	var least *fragment
+	for i := range fragments {
+		if least == nil || len(fragments[i].owners) < len(least.owners) {
+			least = &fragments[i]
+		}
+	}
+	return least
+}
+
+// joinFragments converts fragments back to blocks, joining adjacent
+// fragments covered by the same blocks and dropping the uncovered gaps.
+func joinFragments(fragments []fragment) []cover.ProfileBlock {
+	blocks := make([]cover.ProfileBlock, 0, len(fragments))
+	var last *fragment
+	for i := range fragments {
+		f := &fragments[i]
+		if len(f.owners) == 0 {
+			last = nil
+			continue
+		}
+
+		if last != nil && last.end == f.start && sameOwners(last.owners, f.owners) {
+			b := &blocks[len(blocks)-1]
+			b.EndLine, b.EndCol = f.end.line, f.end.col
+			b.NumStmt += f.numStmt
+			last = f
+			continue
+		}
+
+		blocks = append(blocks, cover.ProfileBlock{
+			StartLine: f.start.line,
+			StartCol:  f.start.col,
+			EndLine:   f.end.line,
+			EndCol:    f.end.col,
+			NumStmt:   f.numStmt,
+			Count:     f.count,
+		})
+		last = f
+	}
+	return blocks
+}
+
+func sameOwners(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package covmerge
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestSplitBlocks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		blocks   []cover.ProfileBlock
+		expected []cover.ProfileBlock
+	}{
+		{
+			name:     "empty",
+			mode:     ModeSet,
+			expected: []cover.ProfileBlock{},
+		},
+		{
+			name: "disjoint",
+			mode: ModeSet,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 3, Count: 1},
+				{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 5, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 3, Count: 1},
+				{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 5, NumStmt: 2, Count: 0},
+			},
+		},
+		{
+			name: "adjacent",
+			mode: ModeSet,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 22, StartCol: 10, EndLine: 25, EndCol: 35, NumStmt: 3, Count: 0},
+				{StartLine: 25, StartCol: 35, EndLine: 26, EndCol: 18, NumStmt: 1, Count: 1},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 22, StartCol: 10, EndLine: 25, EndCol: 35, NumStmt: 3, Count: 0},
+				{StartLine: 25, StartCol: 35, EndLine: 26, EndCol: 18, NumStmt: 1, Count: 1},
+			},
+		},
+		{
+			name: "identical",
+			mode: ModeCount,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 3, Count: 2},
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 3, Count: 5},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 3, Count: 7},
+			},
+		},
+		{
+			name: "partial overlap",
+			mode: ModeSet,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 11, NumStmt: 4, Count: 0},
+				{StartLine: 1, StartCol: 5, EndLine: 1, EndCol: 15, NumStmt: 4, Count: 1},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 5, NumStmt: 4, Count: 0},
+				{StartLine: 1, StartCol: 5, EndLine: 1, EndCol: 11, NumStmt: 0, Count: 1},
+				{StartLine: 1, StartCol: 11, EndLine: 1, EndCol: 15, NumStmt: 4, Count: 1},
+			},
+		},
+		{
+			name: "partial overlap count",
+			mode: ModeCount,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 11, NumStmt: 4, Count: 2},
+				{StartLine: 1, StartCol: 5, EndLine: 1, EndCol: 15, NumStmt: 4, Count: 3},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 5, NumStmt: 4, Count: 2},
+				{StartLine: 1, StartCol: 5, EndLine: 1, EndCol: 11, NumStmt: 0, Count: 5},
+				{StartLine: 1, StartCol: 11, EndLine: 1, EndCol: 15, NumStmt: 4, Count: 3},
+			},
+		},
+		{
+			name: "nested",
+			mode: ModeSet,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 21, NumStmt: 4, Count: 1},
+				{StartLine: 1, StartCol: 6, EndLine: 1, EndCol: 16, NumStmt: 1, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 6, NumStmt: 4, Count: 1},
+				{StartLine: 1, StartCol: 6, EndLine: 1, EndCol: 16, NumStmt: 1, Count: 1},
+				{StartLine: 1, StartCol: 16, EndLine: 1, EndCol: 21, NumStmt: 0, Count: 1},
+			},
+		},
+		{
+			name: "single statements",
+			mode: ModeSet,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 11, NumStmt: 1, Count: 1},
+				{StartLine: 1, StartCol: 6, EndLine: 1, EndCol: 16, NumStmt: 1, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 6, NumStmt: 1, Count: 1},
+				{StartLine: 1, StartCol: 6, EndLine: 1, EndCol: 11, NumStmt: 0, Count: 1},
+				{StartLine: 1, StartCol: 11, EndLine: 1, EndCol: 16, NumStmt: 1, Count: 0},
+			},
+		},
+		{
+			name: "multiple lines",
+			mode: ModeSet,
+			blocks: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 20, EndLine: 5, EndCol: 2, NumStmt: 3, Count: 1},
+				{StartLine: 2, StartCol: 10, EndLine: 3, EndCol: 3, NumStmt: 1, Count: 0},
+				{StartLine: 4, StartCol: 1, EndLine: 6, EndCol: 2, NumStmt: 2, Count: 0},
+			},
+			expected: []cover.ProfileBlock{
+				{StartLine: 1, StartCol: 20, EndLine: 2, EndCol: 10, NumStmt: 3, Count: 1},
+				{StartLine: 2, StartCol: 10, EndLine: 3, EndCol: 3, NumStmt: 1, Count: 1},
+				{StartLine: 3, StartCol: 3, EndLine: 4, EndCol: 1, NumStmt: 0, Count: 1},
+				{StartLine: 4, StartCol: 1, EndLine: 5, EndCol: 2, NumStmt: 0, Count: 1},
+				{StartLine: 5, StartCol: 2, EndLine: 6, EndCol: 2, NumStmt: 2, Count: 0},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			total := numStmts(collapseIdentical(tc.mode, append([]cover.ProfileBlock(nil), tc.blocks...)))
+			actual := splitBlocks(tc.mode, tc.blocks)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+			if n := numStmts(actual); n != total {
+				t.Errorf("expected %d statements, got %d", total, n)
+			}
+		})
+	}
+}
+
+func numStmts(blocks []cover.ProfileBlock) int {
+	n := 0
+	for _, b := range blocks {
+		n += b.NumStmt
+	}
+	return n
+}
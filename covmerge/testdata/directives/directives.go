@@ -0,0 +1,28 @@
+// Package directives is used to test coverage exclusion comments.
+package directives
+
+import "errors"
+
+// Check fails on negative values.
+func Check(n int) error {
+	if n < 0 {
+		//coverage:ignore
+		return errors.New("negative")
+	}
+	if n > 100 { //coverage:ignore unreachable
+		panic("large")
+	}
+	//coverage:ignore-start
+	if n == 100 {
+		return nil
+	}
+	//coverage:ignore-end
+	return nil
+}
+
+//coverage:ignore
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
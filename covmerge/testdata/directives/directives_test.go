@@ -0,0 +1,9 @@
+package directives
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	if err := Check(1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,12 @@
+// Command sample exercises the sample package for binary coverage tests.
+package main
+
+import (
+	"fmt"
+
+	"example.com/sample"
+)
+
+func main() {
+	fmt.Println(sample.Classify(42))
+}
@@ -0,0 +1,67 @@
+// Package sample is used to test source aware coverage merging.
+package sample
+
+import "errors"
+
+// Classify describes n.
+func Classify(n int) string {
+	if n < 0 {
+		return "negative"
+	} else if n == 0 {
+		return "zero"
+	} else {
+		n++
+	}
+	switch {
+	case n > 100:
+		return "large"
+	case n > 10:
+		return "medium"
+	}
+	return "small"
+}
+
+// Sum adds up values, stopping at the first negative.
+func Sum(values []int) (int, error) {
+	total := 0
+	for _, v := range values {
+		if v < 0 {
+			return 0, errors.New("negative")
+		}
+		total += v
+	}
+	return total, nil
+}
+
+// Apply calls fn for each value.
+func Apply(values []int, fn func(int) int) []int {
+	out := make([]int, 0, len(values))
+	double := func(v int) int {
+		return fn(v) * 2
+	}
+	for i := 0; i < len(values); i++ {
+		out = append(out, double(values[i]))
+	}
+	return out
+}
+
+// Find returns the index of v.
+func Find(values []int, v int) int {
+	i := 0
+loop:
+	if i >= len(values) {
+		return -1
+	}
+	if values[i] == v {
+		return i
+	}
+	i++
+	goto loop
+}
+
+// Must panics on error.
+func Must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,12 @@
+package sample
+
+import "testing"
+
+func TestSample(t *testing.T) {
+	Classify(5)
+	Classify(-1)
+	Sum([]int{1, 2})
+	Apply([]int{1}, func(v int) int { return v })
+	Find([]int{1, 2}, 2)
+	Must(nil)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const commandDiff = "diff"
+
+const diffUsage = `usage: gocovdedup diff [options] <baseline> <new>
+compares the merged coverage of a baseline profile with a new profile
+each profile may be a go cover or LCOV file or a binary coverage directory`
+
+// diffOptions holds the settings of the diff command.
+type diffOptions struct {
+	options
+}
+
+// processDiffArgs parses the diff command line, returning the deduplicated
+// baseline and new profiles.  Each side is merged with the shared merge
+// options, where - reads stdIn.
+func processDiffArgs(args []string, stdIn io.Reader) (*diffOptions, []*cover.Profile, []*cover.Profile, error) {
+	opts := &diffOptions{}
+	flags := newMergeFlags("gocovdedup diff", &opts.options)
+
+	if err := parseFlags(diffUsage, flags, args); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if flags.NArg() != 2 {
+		return nil, nil, nil, usage(diffUsage, flags, fmt.Errorf("expected a baseline and a new profile, got %d", flags.NArg()))
+	}
+
+	if flags.Arg(0) == stdoutPath && flags.Arg(1) == stdoutPath {
+		return nil, nil, nil, usage(diffUsage, flags, errors.New("only one profile can be read from stdin"))
+	}
+
+	sides := make([][]*cover.Profile, 2)
+	for i, file := range flags.Args() {
+		merger, err := newMerger(&opts.options, []string{file}, stdIn)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if sides[i], err = merger.Merge(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return opts, sides[0], sides[1], nil
+}
+
+// lineRange is an inclusive range of source lines.
+type lineRange struct {
+	start, end int
+}
+
+func (r lineRange) String() string {
+	if r.start == r.end {
+		return strconv.Itoa(r.start)
+	}
+	return fmt.Sprintf("%d-%d", r.start, r.end)
+}
+
+// lineRanges collapses sorted line numbers into ranges of consecutive lines.
+func lineRanges(lines []int) []lineRange {
+	var ranges []lineRange
+	for _, line := range lines {
+		if n := len(ranges); n > 0 && ranges[n-1].end+1 == line {
+			ranges[n-1].end = line
+			continue
+		}
+		ranges = append(ranges, lineRange{line, line})
+	}
+	return ranges
+}
+
+// funcDiff is the change in coverage of a function.
+type funcDiff struct {
+	name       string
+	base, head stmtCount
+}
+
+// fileDiff is the change in coverage of a file.  A file only present in one
+// profile has been added or removed.
+type fileDiff struct {
+	name         string
+	base, head   *stmtCount
+	funcs        []funcDiff
+	gained, lost []lineRange
+}
+
+// changed reports whether the file's coverage differs between the profiles.
+func (d *fileDiff) changed() bool {
+	return d.base == nil || d.head == nil || *d.base != *d.head ||
+		len(d.funcs) > 0 || len(d.gained) > 0 || len(d.lost) > 0
+}
+
+// diffProfiles compares the coverage of the baseline and new profiles, which
+// must be sorted by file name with their blocks in order.  Lines and functions
+// are matched by position, so they are only meaningful where the source is
+// unchanged between the profiles.  Functions are only compared when resolver
+// is not nil, and files whose source cannot be found are reported as warnings.
+func diffProfiles(base, head []*cover.Profile, resolver *covmerge.Resolver) ([]fileDiff, []error) {
+	byName := func(profiles []*cover.Profile) map[string]*cover.Profile {
+		m := make(map[string]*cover.Profile, len(profiles))
+		for _, profile := range profiles {
+			m[profile.FileName] = profile
+		}
+		return m
+	}
+	baseFiles, headFiles := byName(base), byName(head)
+
+	var names []string
+	for name := range baseFiles {
+		names = append(names, name)
+	}
+	for name := range headFiles {
+		if _, found := baseFiles[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []fileDiff
+	var warnings []error
+	for _, name := range names {
+		d := fileDiff{name: name}
+		baseProfile, headProfile := baseFiles[name], headFiles[name]
+		if baseProfile != nil {
+			d.base = &stmtCount{}
+			d.base.add(baseProfile)
+		}
+		if headProfile != nil {
+			d.head = &stmtCount{}
+			d.head.add(headProfile)
+		}
+
+		if baseProfile != nil && headProfile != nil {
+			d.gained, d.lost = diffLines(baseProfile, headProfile)
+			if resolver != nil {
+				funcs, err := diffFuncs(baseProfile, headProfile, resolver)
+				if err != nil {
+					warnings = append(warnings, err)
+				}
+				d.funcs = funcs
+			}
+		}
+
+		if d.changed() {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, warnings
+}
+
+// diffLines returns the lines instrumented in both profiles that are only
+// covered by the new profile, and those only covered by the baseline.
+func diffLines(base, head *cover.Profile) (gained, lost []lineRange) {
+	covered := make(map[int]bool)
+	for _, hit := range covmerge.LineHits(base) {
+		covered[hit.Line] = hit.Count > 0
+	}
+
+	var gainedLines, lostLines []int
+	for _, hit := range covmerge.LineHits(head) {
+		wasCovered, found := covered[hit.Line]
+		switch {
+		case !found:
+		case hit.Count > 0 && !wasCovered:
+			gainedLines = append(gainedLines, hit.Line)
+		case hit.Count == 0 && wasCovered:
+			lostLines = append(lostLines, hit.Line)
+		}
+	}
+	return lineRanges(gainedLines), lineRanges(lostLines)
+}
+
+// diffFuncs compares the coverage of each function in the current source.
+func diffFuncs(base, head *cover.Profile, resolver *covmerge.Resolver) ([]funcDiff, error) {
+	file, err := resolver.Resolve(head.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs, err := findFuncs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []funcDiff
+	for _, f := range funcs {
+		var d funcDiff
+		d.name = f.name
+		d.base.covered, d.base.total = f.coverage(base)
+		d.head.covered, d.head.total = f.coverage(head)
+		if d.base != d.head {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+// change formats the change between two coverage percentages.
+func change(base, head stmtCount) string {
+	return fmt.Sprintf("%.1f%% -> %.1f%% (%+.1f%%)", base.percent(), head.percent(), head.percent()-base.percent())
+}
+
+// printDiff writes the change in total coverage followed by every file that changed.
+func printDiff(base, head []*cover.Profile, diffs []fileDiff, w io.Writer) {
+	var baseTotal, headTotal stmtCount
+	for _, profile := range base {
+		baseTotal.add(profile)
+	}
+	for _, profile := range head {
+		headTotal.add(profile)
+	}
+	fmt.Fprintf(w, "total: %s\n", change(baseTotal, headTotal))
+
+	for _, d := range diffs {
+		switch {
+		case d.base == nil:
+			fmt.Fprintf(w, "%s: added %.1f%%\n", d.name, d.head.percent())
+			continue
+		case d.head == nil:
+			fmt.Fprintf(w, "%s: removed %.1f%%\n", d.name, d.base.percent())
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", d.name, change(*d.base, *d.head))
+		for _, f := range d.funcs {
+			fmt.Fprintf(w, "  func %s: %s\n", f.name, change(f.base, f.head))
+		}
+		if len(d.gained) > 0 {
+			fmt.Fprintf(w, "  gained lines: %s\n", joinRanges(d.gained))
+		}
+		if len(d.lost) > 0 {
+			fmt.Fprintf(w, "  lost lines: %s\n", joinRanges(d.lost))
+		}
+	}
+}
+
+// joinRanges formats line ranges as a comma separated list.
+func joinRanges(ranges []lineRange) string {
+	values := make([]string, len(ranges))
+	for i, r := range ranges {
+		values[i] = r.String()
+	}
+	return strings.Join(values, ", ")
+}
+
+// runDiff runs the diff command.  The function breakdown is skipped when
+// the -src directory is not within a Go module.
+func runDiff(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, base, head, err := processDiffArgs(args, stdin)
+	if err != nil {
+		return err
+	}
+	printWarnings(opts.warnings, stderr)
+
+	// without a module there is no source for the function breakdown
+	resolver, _ := covmerge.NewResolver(opts.src)
+
+	diffs, warnings := diffProfiles(base, head, resolver)
+	printWarnings(warnings, stderr)
+	printDiff(base, head, diffs, stdout)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestLineRanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lines    []int
+		expected []lineRange
+	}{
+		{"none", nil, nil},
+		{"single", []int{3}, []lineRange{{3, 3}}},
+		{"runs", []int{1, 2, 3, 5, 7, 8}, []lineRange{{1, 3}, {5, 5}, {7, 8}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := lineRanges(tc.lines); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+
+	if s := joinRanges([]lineRange{{1, 3}, {5, 5}}); s != "1-3, 5" {
+		t.Errorf("unexpected ranges %q", s)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	base := &cover.Profile{Blocks: []cover.ProfileBlock{
+		{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 10, NumStmt: 2, Count: 1},
+		{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 10, NumStmt: 2, Count: 0},
+		{StartLine: 5, StartCol: 1, EndLine: 5, EndCol: 10, NumStmt: 1, Count: 1},
+	}}
+	head := &cover.Profile{Blocks: []cover.ProfileBlock{
+		{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 10, NumStmt: 2, Count: 0},
+		{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 10, NumStmt: 2, Count: 1},
+		{StartLine: 6, StartCol: 1, EndLine: 6, EndCol: 10, NumStmt: 1, Count: 1},
+	}}
+
+	gained, lost := diffLines(base, head)
+	if expected := []lineRange{{3, 4}}; !reflect.DeepEqual(gained, expected) {
+		t.Errorf("expected gained %v, got %v", expected, gained)
+	}
+	if expected := []lineRange{{1, 2}}; !reflect.DeepEqual(lost, expected) {
+		t.Errorf("expected lost %v, got %v", expected, lost)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"diff", "-src", "covmerge/testdata/module", "covmerge/testdata/module/baseline.out", "covmerge/testdata/module/sample.out"}
+	if err := runDiff(args, nil, &stdout, &stderr); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := `total: 84.8% -> 80.6% (-4.2%)
+example.com/sample/old.go: removed 100.0%
+example.com/sample/sample.go: 83.9% -> 80.6% (-3.2%)
+  func Classify: 77.8% -> 66.7% (-11.1%)
+  func Sum: 100.0% -> 83.3% (-16.7%)
+  func Apply: 83.3% -> 100.0% (+16.7%)
+  gained lines: 43
+  lost lines: 11, 29
+`
+	if stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("unexpected warnings %s", stderr.String())
+	}
+}
+
+func TestRunDiffWithoutSource(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"diff", "-src", t.TempDir(), "covmerge/testdata/module/sample.out", "covmerge/testdata/module/baseline.out"}
+	if err := runDiff(args, nil, &stdout, &stderr); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := `total: 80.6% -> 84.8% (+4.2%)
+example.com/sample/old.go: added 100.0%
+example.com/sample/sample.go: 80.6% -> 83.9% (+3.2%)
+  gained lines: 11, 29
+  lost lines: 43
+`
+	if stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+}
+
+func TestRunDiffUnchanged(t *testing.T) {
+	var stdout bytes.Buffer
+	args := []string{"diff", "-src", "covmerge/testdata/module", "covmerge/testdata/module/sample.out", "covmerge/testdata/module/sample.out"}
+	if err := runDiff(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if expected := "total: 80.6% -> 80.6% (+0.0%)\n"; stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+}
+
+func TestRunDiffStdin(t *testing.T) {
+	data, err := os.ReadFile("covmerge/testdata/module/sample.out")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var stdout bytes.Buffer
+	args := []string{"diff", "-src", "covmerge/testdata/module", "-", "covmerge/testdata/module/sample.out"}
+	if err := runDiff(args, bytes.NewReader(data), &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if expected := "total: 80.6% -> 80.6% (+0.0%)\n"; stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+}
+
+func TestRunDiffMissingSource(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"diff", "-src", "covmerge/testdata/module", "testdata/cover_1.out", "testdata/cover_2.out"}
+	if err := runDiff(args, nil, &stdout, &stderr); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if stderr.Len() == 0 {
+		t.Error("expected source not found warning")
+	}
+}
+
+func TestProcessDiffArgsErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		args  []string
+		usage bool
+	}{
+		{"no files", []string{"diff"}, true},
+		{"one file", []string{"diff", "testdata/cover_1.out"}, true},
+		{"three files", []string{"diff", "a", "b", "c"}, true},
+		{"stdin twice", []string{"diff", "-", "-"}, true},
+		{"help", []string{"diff", "-h"}, true},
+		{"bad flag", []string{"diff", "-bad", "a", "b"}, true},
+		{"bad mode", []string{"diff", "-mode", "bad", "a", "b"}, false},
+		{"missing file", []string{"diff", "testdata/cover_1.out", "testdata/missing.out"}, false},
+		{"bad merge", []string{"diff", "-merge", "bad", "testdata/cover_1.out", "testdata/cover_2.out"}, false},
+		{"none included", []string{"diff", "-include", "missing.go", "testdata/cover_1.out", "testdata/cover_2.out"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := processDiffArgs(tc.args, nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var usageErr *usageError
+			if errors.As(err, &usageErr) != tc.usage {
+				t.Errorf("unexpected usage %v: %v", tc.usage, err)
+			}
+		})
+	}
+}
+
+func TestDiffUsage(t *testing.T) {
+	_, _, _, err := processDiffArgs([]string{"diff", "a"}, nil)
+
+	expected := "expected a baseline and a new profile, got 1\n\n" + diffUsage
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"text/tabwriter"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+// position is a line and column location within a source file.
+type position struct {
+	line, col int
+}
+
+func (p position) before(o position) bool {
+	return p.line < o.line || (p.line == o.line && p.col < o.col)
+}
+
+// funcExtent is the source range of a function declaration.
+type funcExtent struct {
+	name       string
+	start, end position
+}
+
+// findFuncs returns the functions with bodies declared in a Go source file.
+func findFuncs(fileName string) ([]funcExtent, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var funcs []funcExtent
+	ast.Inspect(file, func(node ast.Node) bool {
+		if fn, ok := node.(*ast.FuncDecl); ok && fn.Body != nil {
+			start := fset.Position(fn.Pos())
+			end := fset.Position(fn.End())
+			funcs = append(funcs, funcExtent{
+				name:  fn.Name.Name,
+				start: position{start.Line, start.Column},
+				end:   position{end.Line, end.Column},
+			})
+		}
+		return true
+	})
+	return funcs, nil
+}
+
+// coverage returns the covered and total statements of the sorted blocks within the function.
+func (f funcExtent) coverage(profile *cover.Profile) (covered, total int) {
+	for _, b := range profile.Blocks {
+		if !(position{b.StartLine, b.StartCol}).before(f.end) {
+			break
+		}
+		if !f.start.before(position{b.EndLine, b.EndCol}) {
+			continue
+		}
+		total += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+	}
+	return covered, total
+}
+
+// percent returns covered as a percentage of total.
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// printFuncs creates a formatter writing the statement coverage of every
+// function followed by the total, in the same layout as go tool cover -func.
+func printFuncs(resolver *covmerge.Resolver) formatter {
+	return func(profiles []*cover.Profile, w io.Writer) error {
+		tabber := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+
+		var covered, total int
+		for _, profile := range profiles {
+			file, err := resolver.Resolve(profile.FileName)
+			if err != nil {
+				return err
+			}
+
+			funcs, err := findFuncs(file)
+			if err != nil {
+				return err
+			}
+
+			for _, f := range funcs {
+				c, t := f.coverage(profile)
+				fmt.Fprintf(tabber, "%s:%d:\t%s\t%.1f%%\n", profile.FileName, f.start.line, f.name, percent(c, t))
+				covered += c
+				total += t
+			}
+		}
+		fmt.Fprintf(tabber, "total:\t(statements)\t%.1f%%\n", percent(covered, total))
+
+		return tabber.Flush()
+	}
+}
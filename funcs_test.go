@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestFindFuncs(t *testing.T) {
+	funcs, err := findFuncs("covmerge/testdata/module/sample.go")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"Classify", "Sum", "Apply", "Find", "Must"}
+	if len(funcs) != len(expected) {
+		t.Fatal("len wrong", len(funcs))
+	}
+	for i, name := range expected {
+		if funcs[i].name != name {
+			t.Errorf("expected %s, got %s", name, funcs[i].name)
+		}
+	}
+
+	if funcs[0].start != (position{7, 1}) || funcs[0].end != (position{22, 2}) {
+		t.Errorf("unexpected extent %v", funcs[0])
+	}
+}
+
+func TestFuncCoverage(t *testing.T) {
+	f := funcExtent{name: "f", start: position{10, 1}, end: position{20, 2}}
+	profile := &cover.Profile{Blocks: []cover.ProfileBlock{
+		{StartLine: 5, StartCol: 1, EndLine: 8, EndCol: 2, NumStmt: 4, Count: 1},
+		{StartLine: 10, StartCol: 20, EndLine: 12, EndCol: 2, NumStmt: 2, Count: 1},
+		{StartLine: 13, StartCol: 2, EndLine: 19, EndCol: 2, NumStmt: 3, Count: 0},
+		{StartLine: 22, StartCol: 1, EndLine: 24, EndCol: 2, NumStmt: 4, Count: 1},
+	}}
+
+	covered, total := f.coverage(profile)
+	if covered != 2 || total != 5 {
+		t.Errorf("expected 2 of 5, got %d of %d", covered, total)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	if p := percent(0, 0); p != 0 {
+		t.Errorf("expected 0, got %f", p)
+	}
+	if p := percent(1, 4); p != 25 {
+		t.Errorf("expected 25, got %f", p)
+	}
+}
+
+func TestPrintFuncs(t *testing.T) {
+	_, profiles, err := mergeArgs([]string{"app", "covmerge/testdata/module/sample.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	write, err := newFormatter(formatFunc, &options{src: "covmerge/testdata/module"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// matches go tool cover -func for the same profile
+	expected := `example.com/sample/sample.go:7:		Classify	66.7%
+example.com/sample/sample.go:25:	Sum		83.3%
+example.com/sample/sample.go:37:	Apply		100.0%
+example.com/sample/sample.go:49:	Find		87.5%
+example.com/sample/sample.go:63:	Must		50.0%
+total:					(statements)	80.6%
+`
+
+	var buf bytes.Buffer
+	if err := write(profiles, &buf); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintFuncsMissingSource(t *testing.T) {
+	write, err := newFormatter(formatFunc, &options{src: "covmerge/testdata/module"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if err := write(loadProfiles(t, "testdata/cover_1.out"), &bytes.Buffer{}); err == nil {
+		t.Error("expected missing source error")
+	}
+}
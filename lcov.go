@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+// printLCOV writes the profiles as an LCOV tracefile with a record per
+// file.  Source files are named by their path within the module of resolver.
+func printLCOV(resolver *covmerge.Resolver) func(profiles []*cover.Profile, w io.Writer) {
+	return func(profiles []*cover.Profile, w io.Writer) {
+		fmt.Fprintln(w, "TN:")
+		for _, profile := range profiles {
+			printLCOVRecord(profile, resolver, w)
+		}
+	}
+}
+
+// printLCOVRecord writes the LCOV record of a single file.
+func printLCOVRecord(profile *cover.Profile, resolver *covmerge.Resolver, w io.Writer) {
+	fmt.Fprintf(w, "SF:%s\n", sourcePath(resolver, profile.FileName))
+
+	hits := covmerge.LineHits(profile)
+	covered := 0
+	for _, hit := range hits {
+		fmt.Fprintf(w, "DA:%d,%d\n", hit.Line, hit.Count)
+		if hit.Count > 0 {
+			covered++
+		}
+	}
+
+	fmt.Fprintf(w, "LF:%d\n", len(hits))
+	fmt.Fprintf(w, "LH:%d\n", covered)
+	fmt.Fprintln(w, "end_of_record")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+)
+
+func TestPrintLCOV(t *testing.T) {
+	disjoint := loadProfiles(t, "testdata/cover_1.out")
+	disjoint[0].FileName = "github.com/repo/gocovdedup/alt.go"
+	profiles := covmerge.DeDuplicate(append(loadProfiles(t, "testdata/cover_1.out"), disjoint...))
+	profiles[0].Blocks[0].Count = 2
+
+	var buf bytes.Buffer
+	printLCOV(nil)(profiles, &buf)
+
+	expected := `TN:
+SF:github.com/repo/gocovdedup/alt.go
+DA:17,2
+DA:18,2
+DA:19,2
+DA:20,0
+DA:21,0
+DA:22,0
+DA:23,0
+DA:24,0
+DA:25,0
+DA:26,0
+LF:10
+LH:3
+end_of_record
+SF:github.com/repo/gocovdedup/main.go
+DA:17,0
+DA:18,0
+DA:19,0
+DA:20,0
+DA:21,0
+DA:22,0
+DA:23,0
+DA:24,0
+DA:25,0
+DA:26,0
+LF:10
+LH:0
+end_of_record
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestProcessArgsFormat(t *testing.T) {
+	opts, _, err := processArgs([]string{"app", "-format", "lcov", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if opts.format != formatLCOV {
+		t.Errorf("expected lcov, got %s", opts.format)
+	}
+
+	if _, _, err := processArgs([]string{"app", "-format", "html", "testdata/cover_1.out"}, nil); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
+
+func TestLCOVRoundTrip(t *testing.T) {
+	var buf strings.Builder
+	printLCOV(nil)(covmerge.DeDuplicate(loadProfiles(t, "testdata/cover_1.out")), &buf)
+
+	profiles, err := covmerge.ParseProfiles(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var again strings.Builder
+	printLCOV(nil)(covmerge.DeDuplicate(profiles), &again)
+	if buf.String() != again.String() {
+		t.Errorf("expected\n%s\ngot\n%s", buf.String(), again.String())
+	}
+}
+
+func TestLCOVSourcePaths(t *testing.T) {
+	for _, args := range [][]string{
+		{"app", "-format", "lcov", "-src", "covmerge/testdata/module", "covmerge/testdata/module/sample.out", "testdata/cover_1.out"},
+		{"app", "-format", "lcov", "-max-blocks", "5", "-src", "covmerge/testdata/module", "covmerge/testdata/module/sample.out", "testdata/cover_1.out"},
+	} {
+		var stdout bytes.Buffer
+		if err := runMerge(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		var files []string
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if strings.HasPrefix(line, "SF:") {
+				files = append(files, strings.TrimPrefix(line, "SF:"))
+			}
+		}
+
+		expected := []string{"sample.go", "github.com/repo/gocovdedup/main.go"}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("%v: expected %v, got %v", args, expected, files)
+		}
+	}
+}
+
+func TestMergeLCOVWithSetProfiles(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runMerge([]string{"app", "testdata/cover_1.out", "covmerge/testdata/cover.info"}, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !strings.HasPrefix(stdout.String(), "mode: set\n") {
+		t.Errorf("expected set mode, got\n%s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "github.com/repo/gocovdedup/other.go:5.1,6.1 1 1\n") {
+		t.Errorf("expected the LCOV line to end at the next line, got\n%s", stdout.String())
+	}
+}
@@ -2,183 +2,305 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
-	"sort"
+	"path/filepath"
+	"strings"
 
+	"github.com/nehemming/gocovdedup/covmerge"
 	"golang.org/x/tools/cover"
 )
 
-var errHelp = errors.New(`usage: gocovdedup [<file1> <file2> ... <fileN>|-]
-files must be in go cover format or if '-' is supplied then read from stdin`)
-
-func processArgs(args []string, stdIn io.Reader) ([]*cover.Profile, error) {
-	var profiles []*cover.Profile
-	switch len(args) {
-	case 1:
-		return nil, errHelp
-	default:
-		var files []string
-		readStdin := false
-		for _, arg := range args[1:] {
-			if arg == "-" {
-				readStdin = true
-			} else {
-				files = append(files, arg)
-			}
-		}
+const commandMerge = "merge"
 
-		if readStdin {
-			stdInProfiles, err := cover.ParseProfilesFromReader(stdIn)
-			if err != nil {
-				return nil, err
-			}
-			profiles = append(profiles, stdInProfiles...)
-		}
+const mergeUsage = `usage: gocovdedup [merge] [options] [<file1> <file2> ... <fileN>|-]
+merges and deduplicates the profiles, writing the result to stdout or -o
+files must be in go cover or LCOV format or if '-' is supplied then read from stdin
+directories are searched for profiles and binary coverage data written to GOCOVERDIR
+and glob patterns, where ** matches any number of directories, are expanded`
 
-		fileProfiles, err := loadProfilesForFiles(files)
-		if err != nil {
-			return nil, err
-		}
+// usageError reports a command line that cannot be run along with the
+// command's usage.  A nil err means the usage was asked for.
+type usageError struct {
+	usage string
+	err   error
+}
 
-		profiles = append(profiles, fileProfiles...)
+func (e *usageError) Error() string {
+	if e.err == nil {
+		return e.usage
 	}
+	return fmt.Sprintf("%s\n\n%s", e.err, e.usage)
+}
 
-	return profiles, nil
+func (e *usageError) Unwrap() error {
+	return e.err
 }
 
-func loadProfilesForFiles(files []string) ([]*cover.Profile, error) {
-	profiles := []*cover.Profile{}
-	for _, file := range files {
-		profile, err := cover.ParseProfiles(file)
-		if err != nil {
-			return nil, err
-		}
-		profiles = append(profiles, profile...)
+// errNoProfiles is the usage problem of a command given no profiles.
+var errNoProfiles = errors.New("no profiles given")
+
+// usage returns a command's usage error, the usage text extended with the
+// option defaults of flags.
+func usage(text string, flags *flag.FlagSet, err error) error {
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+	flags.PrintDefaults()
+	flags.SetOutput(io.Discard)
+	if buf.Len() > 0 {
+		text = fmt.Sprintf("%s\n\noptions:\n%s", text, strings.TrimRight(buf.String(), "\n"))
 	}
-	return profiles, nil
+	return &usageError{usage: text, err: err}
 }
 
-type orderedBlocks []cover.ProfileBlock
-
-func (b orderedBlocks) Len() int      { return len(b) }
-func (b orderedBlocks) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
-func (b orderedBlocks) Less(i, j int) bool {
-	if b[i].StartLine < b[j].StartLine {
-		return true
+// parseFlags parses the command line args, whose first element names the
+// command, returning a usage error for -h or bad flags.
+func parseFlags(text string, flags *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		return nil
 	}
-
-	if b[i].StartLine == b[j].StartLine {
-		if b[i].StartCol < b[j].StartCol {
-			return true
-		}
-		if b[i].StartCol == b[j].StartCol {
-			if b[i].EndLine < b[j].EndLine {
-				return true
-			}
-			if b[i].EndLine == b[j].EndLine {
-				if b[i].EndCol < b[j].EndCol {
-					return true
-				}
-			}
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return usage(text, flags, nil)
 		}
+		return usage(text, flags, err)
 	}
+	return nil
+}
+
+// options holds the settings parsed from the command line.
+type options struct {
+	mode        string
+	merge       string
+	src         string
+	format      string
+	minTotal    float64
+	minPackage  thresholdsFlag
+	minFile     thresholdsFlag
+	ignore      stringsFlag
+	include     stringsFlag
+	includeFile stringsFlag
+	skipGen     bool
+	directives  bool
+	rewrites    []covmerge.Rewrite
+	outputs     outputsFlag
+	inputs      []covmerge.Input
+	warnings    []error
+	read        readCounts
+	by          string
+	maxBlocks   int
+	jobs        int
+	pattern     string
+}
+
+// stringsFlag collects the values of a repeated flag.
+type stringsFlag []string
+
+// String implements flag.Value.
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set implements flag.Value.
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
 
-	return false
+// newMergeFlags creates the flag set of a command that merges profiles,
+// holding the options shared by those commands.
+func newMergeFlags(name string, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&opts.mode, "mode", "", "convert all profiles to `mode` (set, count or atomic) instead of failing on mixed modes")
+	flags.StringVar(&opts.merge, "merge", covmerge.StrategyUnion, "overlapping block merge `strategy`: union, split or source")
+	flags.Var(&opts.ignore, "ignore", "gitignore style exclusion `file`, may be repeated to layer files in order (default discover .coverignore files)")
+	flags.Var(&opts.include, "include", "only keep files matching the gitignore style `pattern`, may be repeated")
+	flags.Var(&opts.includeFile, "include-file", "only keep files matching the patterns in `file`, may be repeated")
+	flags.BoolVar(&opts.skipGen, "skip-generated", false, "exclude generated source files, marked with a // Code generated ... DO NOT EDIT. comment")
+	flags.BoolVar(&opts.directives, "directives", false, "remove blocks excluded by //coverage:ignore comments in the source")
+	flags.Var(&rewritesFlag{rules: &opts.rewrites}, "rewrite", "replace the file name prefix `from=to`, may be repeated")
+	flags.Var(&rewritesFlag{rules: &opts.rewrites, regexp: true}, "rewrite-regexp", "replace file name regular expression matches `expr=replacement`, may be repeated")
+	flags.StringVar(&opts.src, "src", ".", "`dir`ectory within the Go module used to find source files")
+	flags.StringVar(&opts.pattern, "pattern", "*", "only add files found in directories whose names match the glob `pattern`")
+	flags.IntVar(&opts.jobs, "j", 0, "parse and merge up to `n` files at once (default the number of CPUs)")
+	return flags
 }
 
-func maxEndLine(b1, b2 *cover.ProfileBlock) (int, int) {
-	if b1.EndLine > b2.EndLine {
-		return b1.EndLine, b1.EndCol
+// addThresholdFlags adds the coverage minimum options to flags.
+func addThresholdFlags(flags *flag.FlagSet, opts *options) {
+	flags.Float64Var(&opts.minTotal, "min", 0, "fail when the total statement coverage is below `percent`")
+	flags.Var(&opts.minPackage, "min-package", "fail when a package's statement coverage is below `[pattern=]percent`, may be repeated")
+	flags.Var(&opts.minFile, "min-file", "fail when a file's statement coverage is below `[pattern=]percent`, may be repeated")
+}
+
+// processArgs parses the merge command line, returning the merger holding
+// the profiles.
+func processArgs(args []string, stdIn io.Reader) (*options, *covmerge.Merger, error) {
+	opts := &options{}
+	flags := newMergeFlags("gocovdedup", opts)
+	flags.StringVar(&opts.format, "format", formatCover, "output `format`: cover, lcov, cobertura, func, provenance or contribution")
+	flags.Var(&opts.outputs, "o", "write the output atomically to `[format=]path` instead of stdout, may be repeated and - writes to stdout")
+	flags.IntVar(&opts.maxBlocks, "max-blocks", 0, "hold at most `n` blocks in memory, spilling the rest to temporary files (default no limit)")
+	addThresholdFlags(flags, opts)
+
+	if err := parseFlags(mergeUsage, flags, args); err != nil {
+		return nil, nil, err
 	}
-	if b2.EndLine > b1.EndLine {
-		return b2.EndLine, b2.EndCol
+
+	if flags.NArg() == 0 {
+		return nil, nil, usage(mergeUsage, flags, errNoProfiles)
 	}
-	if b1.EndCol > b2.EndCol {
-		return b1.EndLine, b1.EndCol
+
+	if opts.maxBlocks < 0 {
+		return nil, nil, usage(mergeUsage, flags, fmt.Errorf("invalid block limit %d", opts.maxBlocks))
 	}
-	return b2.EndLine, b2.EndCol
-}
 
-func combine(profiles []*cover.Profile) map[string]*cover.Profile {
-	fileMap := make(map[string]*cover.Profile)
+	if opts.minTotal < 0 || opts.minTotal > 100 {
+		return nil, nil, fmt.Errorf("invalid coverage percentage %v", opts.minTotal)
+	}
 
-	// combine all blocks by file name
-	for _, profile := range profiles {
-		if p, found := fileMap[profile.FileName]; found {
-			p.Blocks = append(p.Blocks, profile.Blocks...)
-		} else {
-			fileMap[profile.FileName] = profile
+	if !validFormat(opts.format) {
+		return nil, nil, fmt.Errorf("unknown output format %q", opts.format)
+	}
+
+	if len(opts.outputs) == 0 {
+		opts.outputs = outputsFlag{{path: stdoutPath}}
+	}
+	paths := make(map[string]bool, len(opts.outputs))
+	for i := range opts.outputs {
+		o := &opts.outputs[i]
+		if o.format == "" {
+			o.format = opts.format
+		}
+		if o.path != stdoutPath && paths[filepath.Clean(o.path)] {
+			return nil, nil, fmt.Errorf("duplicate output path %q", o.path)
 		}
+		paths[filepath.Clean(o.path)] = true
 	}
 
-	return fileMap
+	merger, err := newMerger(opts, flags.Args(), stdIn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, merger, nil
 }
 
-type byFileName []*cover.Profile
-
-func (p byFileName) Len() int           { return len(p) }
-func (p byFileName) Less(i, j int) bool { return p[i].FileName < p[j].FileName }
-func (p byFileName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-
-func max(a, b int) int {
-	if a > b {
-		return a
+// newMerger creates the merger configured by opts and adds the profiles of
+// each file, where - reads stdIn.
+func newMerger(opts *options, files []string, stdIn io.Reader) (*covmerge.Merger, error) {
+	ignoreFiles, err := ignoreFilesFor(opts)
+	if err != nil {
+		return nil, err
 	}
-	return b
-}
 
-func overlaps(b1, b2 *cover.ProfileBlock) bool {
-	// return true if b2 overlaps b1
-	if b1.EndLine < b2.StartLine {
-		return false
+	merger, err := covmerge.New(covmerge.Options{
+		Mode:          opts.mode,
+		Strategy:      opts.merge,
+		Src:           opts.src,
+		Include:       opts.include,
+		IncludeFiles:  opts.includeFile,
+		IgnoreFiles:   ignoreFiles,
+		SkipGenerated: opts.skipGen,
+		Directives:    opts.directives,
+		Rewrites:      opts.rewrites,
+		Provenance:    opts.tracksProvenance(),
+		MaxBlocks:     opts.maxBlocks,
+		Workers:       opts.jobs,
+		Warn:          func(err error) { opts.warnings = append(opts.warnings, err) },
+	})
+	if err != nil {
+		return nil, err
 	}
-	if b1.EndLine > b2.StartLine {
-		return true
+
+	if err := opts.addInputs(merger, files, stdIn); err != nil {
+		merger.Close()
+		return nil, err
 	}
-	return b1.EndCol >= b2.StartCol
+
+	opts.inputs = merger.Inputs()
+	return merger, nil
 }
 
-func deDuplicate(profiles []*cover.Profile) []*cover.Profile {
-	combined := combine(profiles)
+// addInputs adds the profiles of each file to merger, reading stdin first.
+// Directories and glob patterns are expanded into the profiles they hold.
+// With a block limit the inputs are streamed into the merger, otherwise
+// they are loaded, up to -j at once, so what was read can be counted.
+func (opts *options) addInputs(merger *covmerge.Merger, files []string, stdIn io.Reader) error {
+	paths, readStdin := splitStdin(files)
+	paths, err := covmerge.FindInputs(paths, opts.pattern)
+	if err != nil {
+		return err
+	}
 
-	result := make([]*cover.Profile, 0, len(combined))
+	if opts.maxBlocks > 0 {
+		if readStdin {
+			if err := merger.AddReader("stdin", stdIn); err != nil {
+				return err
+			}
+		}
+		return merger.AddFiles(paths...)
+	}
 
-	// dedup blocks
-	for _, profile := range combined {
-		sort.Sort(orderedBlocks(profile.Blocks))
+	if readStdin {
+		profiles, err := covmerge.ParseProfiles(stdIn)
+		if err != nil {
+			return err
+		}
+		if err := opts.add(merger, "stdin", profiles); err != nil {
+			return err
+		}
+	}
 
-		// dedup blocks
-		deduped := make([]cover.ProfileBlock, 0, len(profile.Blocks))
-		var current *cover.ProfileBlock
-		for _, blockIterator := range profile.Blocks {
-			block := blockIterator
-			if current == nil {
-				current = &block
-				continue
-			}
-			if overlaps(current, &block) {
-				// merge blocks as overlapping
-				current.EndLine, current.EndCol = maxEndLine(current, &block)
-				current.NumStmt = max(current.NumStmt, block.NumStmt)
-				current.Count = max(current.Count, block.Count)
-			} else {
-				deduped = append(deduped, *current)
-				current = &block
-			}
+	loaded, err := covmerge.LoadAllProfiles(paths, opts.jobs)
+	if err != nil {
+		return err
+	}
+	for i, path := range paths {
+		if err := opts.add(merger, path, loaded[i]); err != nil {
+			return err
 		}
-		if current != nil {
-			deduped = append(deduped, *current)
+	}
+	return nil
+}
+
+// splitStdin separates the - argument, reading stdin, from the paths.
+func splitStdin(files []string) ([]string, bool) {
+	var paths []string
+	readStdin := false
+	for _, file := range files {
+		if file == "-" {
+			readStdin = true
+		} else {
+			paths = append(paths, file)
 		}
+	}
+	return paths, readStdin
+}
 
-		profile.Blocks = deduped
-		result = append(result, profile)
+// add adds an input's profiles to merger, counting what was read.
+func (opts *options) add(merger *covmerge.Merger, name string, profiles []*cover.Profile) error {
+	opts.read.add(profiles)
+	return merger.Add(name, profiles)
+}
+
+// ignoreFilesFor returns the ignore files given by -ignore, or discovers them
+// if none were given.  Ignore files given explicitly must exist.
+func ignoreFilesFor(opts *options) ([]string, error) {
+	if len(opts.ignore) == 0 {
+		return covmerge.DiscoverIgnoreFiles(".")
 	}
 
-	sort.Sort(byFileName(result))
-	return result
+	for _, path := range opts.ignore {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("unable to read ignore file:%s", err)
+		}
+	}
+	return opts.ignore, nil
 }
 
 func printProfile(profile *cover.Profile, w io.Writer) {
@@ -199,23 +321,115 @@ func printProfiles(profiles []*cover.Profile, w io.Writer) {
 	}
 }
 
+// Output formats.
+const (
+	formatCover     = "cover"
+	formatLCOV      = "lcov"
+	formatCobertura = "cobertura"
+	formatFunc      = "func"
+)
+
+// formatter writes merged profiles in an output format.
+type formatter func(profiles []*cover.Profile, w io.Writer) error
+
+// printWith adapts a print function to a formatter.
+func printWith(printer func(profiles []*cover.Profile, w io.Writer)) formatter {
+	return func(profiles []*cover.Profile, w io.Writer) error {
+		printer(profiles, w)
+		return nil
+	}
+}
+
+// newFormatter creates the formatter for an output format.
+func newFormatter(format string, opts *options) (formatter, error) {
+	switch format {
+	case formatCover:
+		return printWith(printProfiles), nil
+	case formatLCOV:
+		return printWith(printLCOV(outputResolver(opts.src))), nil
+	case formatCobertura:
+		return printCobertura(outputResolver(opts.src)), nil
+	case formatFunc:
+		resolver, err := covmerge.NewResolver(opts.src)
+		if err != nil {
+			return nil, err
+		}
+		return printFuncs(resolver), nil
+	case formatProvenance:
+		return printProvenance(opts.inputs), nil
+	case formatContribution:
+		return printContributions(opts.inputs), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// printWarnings reports problems that did not stop the merge.
+func printWarnings(warnings []error, w io.Writer) {
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+}
+
 func checkError(err error, w io.Writer, exit func(code int)) {
 	if err != nil {
-		if errors.Is(err, errHelp) {
+		var usageErr *usageError
+		if errors.As(err, &usageErr) {
 			fmt.Fprintln(w, err)
 			exit(99)
 			return
 		}
 
+		var threshold *thresholdError
+		if errors.As(err, &threshold) {
+			fmt.Fprintln(w, err)
+			exit(2)
+			return
+		}
+
 		fmt.Fprintln(w, err)
 		exit(1)
 	}
 }
 
+// runMerge runs the merge command, writing the merged profiles to the
+// outputs before checking the coverage minimums.  With a block limit the
+// cover and LCOV outputs are written as each file is merged.
+func runMerge(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, merger, err := processArgs(args, stdin)
+	if err != nil {
+		return err
+	}
+	// removes any spilled blocks left when the outputs cannot be written
+	defer merger.Close()
+
+	var files []fileCount
+	if opts.maxBlocks > 0 && opts.streamsOutputs() {
+		files, err = streamOutputs(merger, opts, stdout)
+		printWarnings(opts.warnings, stderr)
+	} else {
+		files, err = mergeOutputs(merger, opts, stdout, stderr)
+	}
+	if err != nil {
+		return err
+	}
+	return checkThresholds(files, opts.minTotal, opts.minPackage, opts.minFile)
+}
+
+// mergeOutputs merges the profiles before writing them to the outputs,
+// returning the statement counts of the merged files.
+func mergeOutputs(merger *covmerge.Merger, opts *options, stdout, stderr io.Writer) ([]fileCount, error) {
+	merged, err := merger.Merge()
+	printWarnings(opts.warnings, stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeOutputs(merged, opts, stdout); err != nil {
+		return nil, err
+	}
+	return fileCounts(merged), nil
+}
+
 func main() {
-	profiles, err := processArgs(os.Args, os.Stdin)
-	checkError(err, os.Stderr, os.Exit)
-	profiles, err = filterProfiles(profiles, ".coverignore")
-	checkError(err, os.Stderr, os.Exit)
-	printProfiles(deDuplicate(profiles), os.Stdout)
+	checkError(run(os.Args, os.Stdin, os.Stdout, os.Stderr), os.Stderr, os.Exit)
 }
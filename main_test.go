@@ -4,9 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"io"
 	"os"
 	"reflect"
-	"sort"
 	"strings"
 	"testing"
 
@@ -136,8 +136,7 @@ func TestCheckError(t *testing.T) {
 		{"nil", nil, "", func(i int) {
 			t.Error("should not be called")
 		}},
-		{"help", errHelp, `usage: gocovdedup [<file1> <file2> ... <fileN>|-]
-files must be in go cover format or if '-' is supplied then read from stdin`, func(i int) {
+		{"usage", &usageError{usage: "usage: gocovdedup", err: errNoProfiles}, "no profiles given\n\nusage: gocovdedup", func(i int) {
 			if i != 99 {
 				t.Errorf("expected 99, got %d", i)
 			}
@@ -149,6 +148,12 @@ files must be in go cover format or if '-' is supplied then read from stdin`, fu
 			}
 			count++
 		}},
+		{"threshold", &thresholdError{violations: []string{"low"}}, "coverage below minimum:\n  low", func(i int) {
+			if i != 2 {
+				t.Errorf("expected 2, got %d", i)
+			}
+			count++
+		}},
 	}
 
 	for _, tc := range testCases {
@@ -168,272 +173,14 @@ files must be in go cover format or if '-' is supplied then read from stdin`, fu
 	}
 }
 
-func TestMax(t *testing.T) {
-	testCases := []struct {
-		name     string
-		a, b     int
-		expected int
-	}{
-		{"a", 1, 0, 1},
-		{"b", 0, 1, 1},
-		{"equal", 1, 1, 1},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual := max(tc.a, tc.b)
-			if actual != tc.expected {
-				t.Errorf("expected %d, got %d", tc.expected, actual)
-			}
-		})
-	}
-}
-
-func TestByFileName(t *testing.T) {
-	// test byFileName sorting
-
-	testCases := []struct {
-		name     string
-		order    []*cover.Profile
-		expected []*cover.Profile
-	}{
-		{"empty", []*cover.Profile{}, []*cover.Profile{}},
-		{"one", []*cover.Profile{{FileName: "a"}}, []*cover.Profile{{FileName: "a"}}},
-		{"two", []*cover.Profile{{FileName: "b"}, {FileName: "a"}}, []*cover.Profile{{FileName: "a"}, {FileName: "b"}}},
-		{"three", []*cover.Profile{{FileName: "b"}, {FileName: "c"}, {FileName: "a"}}, []*cover.Profile{{FileName: "a"}, {FileName: "b"}, {FileName: "c"}}},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			sort.Sort(byFileName(tc.order))
-			if !reflect.DeepEqual(tc.order, tc.expected) {
-				t.Errorf("expected %v, got %v", tc.expected, tc.order)
-			}
-		})
-	}
-}
-
-func TestCombine(t *testing.T) {
-	// test function combine
-	testCases := []struct {
-		name     string
-		order    []*cover.Profile
-		expected map[string]*cover.Profile
-	}{
-		{"empty", []*cover.Profile{}, map[string]*cover.Profile{}},
-		{"one", []*cover.Profile{{FileName: "a"}}, map[string]*cover.Profile{"a": {FileName: "a"}}},
-		{"two", []*cover.Profile{{FileName: "b"}, {FileName: "a"}}, map[string]*cover.Profile{"a": {FileName: "a"}, "b": {FileName: "b"}}},
-		{"three", []*cover.Profile{{FileName: "b"}, {FileName: "c"}, {FileName: "a"}}, map[string]*cover.Profile{"a": {FileName: "a"}, "b": {FileName: "b"}, "c": {FileName: "c"}}},
-		{
-			"blocks",
-			[]*cover.Profile{
-				{FileName: "b", Blocks: []cover.ProfileBlock{{StartLine: 1}}},
-				{FileName: "b", Blocks: []cover.ProfileBlock{{StartLine: 2}}},
-				{FileName: "a"},
-			},
-			map[string]*cover.Profile{
-				"a": {FileName: "a"},
-				"b": {FileName: "b", Blocks: []cover.ProfileBlock{{StartLine: 1}, {StartLine: 2}}},
-			},
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual := combine(tc.order)
-			if !reflect.DeepEqual(actual, tc.expected) {
-				t.Errorf("expected %v, got %v", tc.expected, actual)
-			}
-		})
-	}
-}
-
-func TestMaxEndLine(t *testing.T) {
-	// test function maxEndLine
-	testCases := []struct {
-		name      string
-		a, b      cover.ProfileBlock
-		line, col int
-	}{
-		{
-			name: "equal",
-			a:    cover.ProfileBlock{EndLine: 1, EndCol: 1},
-			b:    cover.ProfileBlock{EndLine: 1, EndCol: 1},
-			line: 1,
-			col:  1,
-		},
-		{
-			name: "disjoint",
-			a:    cover.ProfileBlock{EndLine: 2, EndCol: 25},
-			b:    cover.ProfileBlock{EndLine: 1, EndCol: 1},
-			line: 2,
-			col:  25,
-		},
-		{
-			name: "overlapping",
-			a:    cover.ProfileBlock{EndLine: 1, EndCol: 25},
-			b:    cover.ProfileBlock{EndLine: 7, EndCol: 1},
-			line: 7,
-			col:  1,
-		},
-		{
-			name: "same line",
-			a:    cover.ProfileBlock{EndLine: 7, EndCol: 25},
-			b:    cover.ProfileBlock{EndLine: 7, EndCol: 1},
-			line: 7,
-			col:  25,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			line, col := maxEndLine(&tc.a, &tc.b)
-			if line != tc.line || col != tc.col {
-				t.Errorf("expected %d:%d, got %d:%d", tc.line, tc.col, line, col)
-			}
-		})
-	}
-}
-
-func TestOrderedBlocks(t *testing.T) {
-	// test sorting of orderedBlocks
-	testCases := []struct {
-		name     string
-		blocks   []cover.ProfileBlock
-		expected []cover.ProfileBlock
-	}{
-		{
-			name: "basic",
-			blocks: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-			expected: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-		},
-		{
-			name: "overlapping",
-			blocks: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 16, StartCol: 76, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-			expected: []cover.ProfileBlock{
-				{StartLine: 16, StartCol: 76, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-		},
-		{
-			name: "same start",
-			blocks: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-			expected: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 76, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-		},
-		{
-			name: "same start col",
-			blocks: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-			expected: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 19, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-		},
-		{
-			name: "same end line",
-			blocks: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-			},
-			expected: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 22, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
-			},
-		},
-		{
-			name: "same end line and col",
-			blocks: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
-			},
-			expected: []cover.ProfileBlock{
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
-				{StartLine: 17, StartCol: 32, EndLine: 17, EndCol: 23, NumStmt: 2, Count: 0},
-			},
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual := orderedBlocks(tc.blocks)
-			sort.Sort(actual)
-			if len(actual) != len(tc.expected) {
-				t.Fatal("len wrong", tc.expected, actual)
-			}
-			for i, v := range tc.expected {
-				if v != actual[i] {
-					t.Error("order fail", i, v, actual[i])
-				}
-			}
-		})
-	}
-}
-
-func sp(s string) *string {
-	return &s
-}
-
-func ps(sp *string) string {
-	if sp == nil {
-		return ""
-	}
-	return *sp
-}
-
-func TestLoadProfilesForFiles(t *testing.T) {
-	// test loadProfilesForFiles
-	testCases := []struct {
-		name     string
-		files    []string
-		expected []*cover.Profile
-		err      *string
-	}{
-		{
-			name:  "missing",
-			files: []string{"testdata/notfound.out"},
-			err:   sp("open testdata/notfound.out: no such file or directory"),
-		},
-		{
-			name:     "one",
-			files:    []string{"testdata/cover_1.out"},
-			expected: newProfileOne(),
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual, err := loadProfilesForFiles(tc.files)
-			if err != nil {
-				if tc.err == nil || err.Error() != *tc.err {
-					t.Fatalf("unexpected:\n%s\n%s\n", ps(tc.err), err)
-				}
-			} else if tc.err != nil {
-				t.Fatal("expected", err)
-			}
-			if len(actual) != len(tc.expected) {
-				t.Errorf("len wrong %v %+v\n", tc.expected, actual)
-			}
-
-			if !reflect.DeepEqual(actual, tc.expected) {
-				t.Errorf("wrong %v %+v\n", tc.expected, actual[0])
-			}
-		})
+// mergeArgs processes the arguments and merges the profiles.
+func mergeArgs(args []string, stdIn io.Reader) (*options, []*cover.Profile, error) {
+	opts, merger, err := processArgs(args, stdIn)
+	if err != nil {
+		return nil, nil, err
 	}
+	profiles, err := merger.Merge()
+	return opts, profiles, err
 }
 
 func TestProcessArgsFiles(t *testing.T) {
@@ -442,12 +189,12 @@ func TestProcessArgsFiles(t *testing.T) {
 		"testdata/cover_1.out",
 		"testdata/cover_2.out",
 	}
-	p, err := processArgs(args, nil)
+	_, p, err := mergeArgs(args, nil)
 	if err != nil {
 		t.Error("unexpected err", err)
 	}
-	if len(p) != 2 {
-		t.Error("profiles len != 2", len(p))
+	if len(p) != 1 {
+		t.Error("profiles len != 1", len(p))
 	}
 }
 
@@ -455,13 +202,13 @@ func TestProcessArgsFilesNone(t *testing.T) {
 	args := []string{
 		"app",
 	}
-	p, err := processArgs(args, nil)
-	if !errors.Is(err, errHelp) {
-		t.Error("unexpected not errHelp", err)
+	_, merger, err := processArgs(args, nil)
+	if !errors.Is(err, errNoProfiles) {
+		t.Error("unexpected not errNoProfiles", err)
 	}
 
-	if len(p) != 0 {
-		t.Error("profiles len != 0", len(p))
+	if merger != nil {
+		t.Error("unexpected merger")
 	}
 }
 
@@ -476,7 +223,7 @@ func TestProcessArgsStdIn(t *testing.T) {
 		"-",
 	}
 
-	p, err := processArgs(args, f)
+	_, p, err := mergeArgs(args, f)
 	if err != nil {
 		t.Error("unexpected err", err)
 	}
@@ -485,90 +232,94 @@ func TestProcessArgsStdIn(t *testing.T) {
 	}
 }
 
-func TestOverlaps(t *testing.T) {
-	// test overlaps
-	testCases := []struct {
-		name     string
-		b1       cover.ProfileBlock
-		b2       cover.ProfileBlock
-		expected bool
-	}{
-		{
-			name:     "none",
-			expected: true,
-		},
-		{
-			name:     "same",
-			b1:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1},
-			b2:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1},
-			expected: true,
-		},
-		{
-			name:     "adjacent",
-			b1:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 1},
-			b2:       cover.ProfileBlock{StartLine: 1, StartCol: 2, EndLine: 1, EndCol: 2},
-			expected: false,
-		},
-		{
-			name:     "overlap",
-			b1:       cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 2},
-			b2:       cover.ProfileBlock{StartLine: 1, StartCol: 2, EndLine: 1, EndCol: 3},
-			expected: true,
-		},
+func TestProcessArgsMerge(t *testing.T) {
+	opts, _, err := processArgs([]string{"app", "-merge", "split", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if opts.merge != "split" {
+		t.Errorf("expected split, got %s", opts.merge)
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual := overlaps(&tc.b1, &tc.b2)
-			if actual != tc.expected {
-				t.Error("overlaps fail", tc.expected, actual)
-			}
-		})
+	if _, _, err := processArgs([]string{"app", "-merge", "max", "testdata/cover_1.out"}, nil); err == nil {
+		t.Error("expected unknown strategy error")
 	}
 }
 
-func TestDeDuplicate(t *testing.T) {
-	disjoint := append(newProfileOne(), newDisjoint()...)
-	disjointExpected := append(newCombined("github.com/repo/gocovdedup/alt.go"), newCombined("")...)
-	overlapped := append(newProfileOne(), newProfileOne()...)
-	// Test the deduplication logic
+func TestRunMergeJobs(t *testing.T) {
+	files := []string{"testdata/cover_1.out", "testdata/cover_2.out", "covmerge/testdata/module/sample.out", "covmerge/testdata/module/baseline.out"}
+
+	var expected bytes.Buffer
+	if err := runMerge(append([]string{"app", "-j", "1"}, files...), nil, &expected, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runMerge(append([]string{"app", "-j", "4"}, files...), nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if stdout.String() != expected.String() {
+		t.Errorf("expected\n%s\ngot\n%s", expected.String(), stdout.String())
+	}
+
+	if _, _, err := processArgs([]string{"app", "-j", "-1", "testdata/cover_1.out"}, nil); err == nil {
+		t.Error("expected invalid worker count error")
+	}
+}
+
+func TestRunMergeFindsInputs(t *testing.T) {
+	var expected bytes.Buffer
+	files := []string{"app", "testdata/cover_1.out", "testdata/cover_2.out", "covmerge/testdata/module/baseline.out", "covmerge/testdata/module/sample.out"}
+	if err := runMerge(files, nil, &expected, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
 	testCases := []struct {
-		name     string
-		profiles []*cover.Profile
-		expected []*cover.Profile
+		name string
+		args []string
 	}{
-		{
-			name:     "empty",
-			expected: []*cover.Profile{},
-		},
-		{
-			name:     "combined",
-			profiles: newProfileOne(),
-			expected: newCombined(""),
-		},
-		{
-			name:     "disjoint",
-			profiles: disjoint,
-			expected: disjointExpected,
-		},
-		{
-			name:     "overlapped",
-			profiles: overlapped,
-			expected: newCombined(""),
-		},
+		{"globstar", []string{"app", "testdata/**/*.out", "covmerge/testdata/module/**/*.out"}},
+		{"dir", []string{"app", "testdata", "covmerge/testdata/module"}},
+		{"dir pattern", []string{"app", "-pattern", "*.out", "covmerge/testdata/module", "testdata/cover_?.out"}},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			actual := deDuplicate(tc.profiles)
-			if len(actual) != len(tc.expected) {
-				t.Fatal("len wrong", tc.expected, actual)
+			var stdout bytes.Buffer
+			if err := runMerge(tc.args, nil, &stdout, &bytes.Buffer{}); err != nil {
+				t.Fatal("unexpected error", err)
 			}
-			for i, v := range tc.expected {
-				if !reflect.DeepEqual(v, actual[i]) {
-					t.Errorf("order fail %d\n%v\n%v", i, v, actual[i])
-				}
+			if stdout.String() != expected.String() {
+				t.Errorf("expected\n%s\ngot\n%s", expected.String(), stdout.String())
 			}
 		})
 	}
+
+	if _, _, err := processArgs([]string{"app", "testdata/*.none"}, nil); err == nil {
+		t.Error("expected no match error")
+	}
+}
+
+func TestIgnoreFilesFor(t *testing.T) {
+	files, err := ignoreFilesFor(&options{ignore: stringsFlag{"testdata/filter"}})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !reflect.DeepEqual(files, []string{"testdata/filter"}) {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	if _, err := ignoreFilesFor(&options{ignore: stringsFlag{"testdata/nofile"}}); err == nil {
+		t.Error("expected missing ignore file error")
+	}
+}
+
+func TestPrintWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	printWarnings([]error{errors.New("one"), errors.New("two")}, &buf)
+
+	expected := "warning: one\nwarning: two\n"
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+// outputResolver returns the resolver used to name source files in reports,
+// or nil when src is not within a Go module.
+func outputResolver(src string) *covmerge.Resolver {
+	resolver, err := covmerge.NewResolver(src)
+	if err != nil {
+		return nil
+	}
+	return resolver
+}
+
+// sourcePath returns the path of a profile's source file relative to the
+// module root of resolver.  File names outside the module, or when there is
+// no resolver, are returned unchanged.
+func sourcePath(resolver *covmerge.Resolver, fileName string) string {
+	if resolver != nil {
+		if rel, ok := resolver.Rel(fileName); ok {
+			return rel
+		}
+	}
+	return fileName
+}
+
+// stdoutPath is the output path that writes to standard output.
+const stdoutPath = "-"
+
+// output is a destination for the merged profiles.  An empty format is
+// replaced by the -format option.
+type output struct {
+	format string
+	path   string
+}
+
+// outputsFlag collects repeated [format=]path flag values.
+type outputsFlag []output
+
+// String implements flag.Value.
+func (f *outputsFlag) String() string {
+	values := make([]string, 0, len(*f))
+	for _, o := range *f {
+		value := o.path
+		if o.format != "" {
+			value = o.format + "=" + value
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, ",")
+}
+
+// Set implements flag.Value.  The text before the first = is only treated as
+// a format when it names one, so paths containing = can still be used.
+func (f *outputsFlag) Set(value string) error {
+	var o output
+	o.path = value
+	if format, path, found := strings.Cut(value, "="); found && validFormat(format) {
+		o.format, o.path = format, path
+	}
+	if o.path == "" {
+		return fmt.Errorf("invalid output %q, expected [format=]path", value)
+	}
+
+	*f = append(*f, o)
+	return nil
+}
+
+// validFormat reports whether format is a known output format.
+func validFormat(format string) bool {
+	switch format {
+	case formatCover, formatLCOV, formatCobertura, formatFunc, formatProvenance, formatContribution:
+		return true
+	}
+	return false
+}
+
+// writeOutputs writes the merged profiles to each of the -o outputs.  Files
+// are written to temporary files alongside them and only renamed into place
+// once every output has been written, so a failed run never leaves a
+// truncated file.
+func writeOutputs(profiles []*cover.Profile, opts *options, stdout io.Writer) (err error) {
+	outputs := opts.outputs
+	writers := make([]formatter, len(outputs))
+	for i, o := range outputs {
+		if writers[i], err = newFormatter(o.format, opts); err != nil {
+			return err
+		}
+	}
+
+	temps := make(map[string]string, len(outputs))
+	defer func() {
+		if err != nil {
+			for _, temp := range temps {
+				os.Remove(temp)
+			}
+		}
+	}()
+
+	for i, o := range outputs {
+		if o.path == stdoutPath {
+			if err = writers[i](profiles, stdout); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var temp string
+		temp, err = writeTemp(o.path, func(w io.Writer) error {
+			return writers[i](profiles, w)
+		})
+		if temp != "" {
+			temps[o.path] = temp
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return renameTemps(outputs, temps)
+}
+
+// renameTemps renames the temporary files written for the outputs into
+// place, removing each from temps once renamed.
+func renameTemps(outputs []output, temps map[string]string) error {
+	for _, o := range outputs {
+		if temp, ok := temps[o.path]; ok {
+			if err := os.Rename(temp, o.path); err != nil {
+				return err
+			}
+			delete(temps, o.path)
+		}
+	}
+	return nil
+}
+
+// writeTemp writes a temporary file in the directory of path, returning its
+// name so it can be renamed into place or removed.
+func writeTemp(path string, write func(w io.Writer) error) (string, error) {
+	f, err := openTemp(path)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), closeTemp(f, path, write(f))
+}
+
+// openTemp creates a temporary file in the directory of path.
+func openTemp(path string) (*os.File, error) {
+	return os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+}
+
+// closeTemp finishes a temporary file written for path, unless writing it
+// failed with err, syncing and closing it.
+func closeTemp(f *os.File, path string, err error) error {
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// tracksProvenance reports whether any output needs the provenance of the merged blocks.
+func (opts *options) tracksProvenance() bool {
+	for _, o := range opts.outputs {
+		if o.format == formatProvenance || o.format == formatContribution {
+			return true
+		}
+	}
+	return false
+}
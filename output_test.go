@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputsFlagSet(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected output
+	}{
+		{"cover.out", output{path: "cover.out"}},
+		{"lcov=cover.info", output{format: formatLCOV, path: "cover.info"}},
+		{"cobertura=out/a=b.xml", output{format: formatCobertura, path: "out/a=b.xml"}},
+		{"a=b.out", output{path: "a=b.out"}},
+		{"-", output{path: stdoutPath}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			var f outputsFlag
+			if err := f.Set(tc.value); err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if !reflect.DeepEqual(f, outputsFlag{tc.expected}) {
+				t.Errorf("expected %v, got %v", tc.expected, f)
+			}
+			if f.String() != tc.value {
+				t.Errorf("expected %q, got %q", tc.value, f.String())
+			}
+		})
+	}
+
+	var f outputsFlag
+	if err := f.Set("lcov="); err == nil {
+		t.Error("expected missing path error")
+	}
+}
+
+func TestProcessArgsOutputs(t *testing.T) {
+	opts, _, err := processArgs([]string{"app", "-format", "lcov", "-o", "a.info", "-o", "cover=a.out", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := outputsFlag{{format: formatLCOV, path: "a.info"}, {format: formatCover, path: "a.out"}}
+	if !reflect.DeepEqual(opts.outputs, expected) {
+		t.Errorf("expected %v, got %v", expected, opts.outputs)
+	}
+
+	opts, _, err = processArgs([]string{"app", "-format", "lcov", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected = outputsFlag{{format: formatLCOV, path: stdoutPath}}
+	if !reflect.DeepEqual(opts.outputs, expected) {
+		t.Errorf("expected %v, got %v", expected, opts.outputs)
+	}
+
+	if _, _, err := processArgs([]string{"app", "-o", "a.out", "-o", "lcov=./a.out", "testdata/cover_1.out"}, nil); err == nil {
+		t.Error("expected duplicate output error")
+	}
+}
+
+func TestWriteOutputs(t *testing.T) {
+	dir := t.TempDir()
+	coverFile := filepath.Join(dir, "cover.out")
+	lcovFile := filepath.Join(dir, "cover.info")
+	writeFile(t, coverFile, "stale")
+
+	outputs := []output{
+		{format: formatCover, path: coverFile},
+		{format: formatLCOV, path: stdoutPath},
+		{format: formatLCOV, path: lcovFile},
+	}
+
+	var stdout bytes.Buffer
+	if err := writeOutputs(loadProfiles(t, "testdata/cover_1.out"), &options{outputs: outputs, src: "."}, &stdout); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var expected bytes.Buffer
+	printProfiles(loadProfiles(t, "testdata/cover_1.out"), &expected)
+	if data, _ := os.ReadFile(coverFile); string(data) != expected.String() {
+		t.Errorf("expected\n%s\ngot\n%s", expected.String(), data)
+	}
+
+	expected.Reset()
+	printLCOV(nil)(loadProfiles(t, "testdata/cover_1.out"), &expected)
+	if data, _ := os.ReadFile(lcovFile); string(data) != expected.String() {
+		t.Errorf("expected\n%s\ngot\n%s", expected.String(), data)
+	}
+	if stdout.String() != expected.String() {
+		t.Errorf("expected\n%s\ngot\n%s", expected.String(), stdout.String())
+	}
+
+	assertNoTemps(t, dir)
+}
+
+func TestWriteOutputsFailure(t *testing.T) {
+	dir := t.TempDir()
+	coverFile := filepath.Join(dir, "cover.out")
+	funcFile := filepath.Join(dir, "func.txt")
+	writeFile(t, coverFile, "stale")
+
+	// the func report fails as the profile source is not in the module,
+	// so the cover output must not replace the existing file
+	outputs := []output{
+		{format: formatCover, path: coverFile},
+		{format: formatFunc, path: funcFile},
+	}
+
+	if err := writeOutputs(loadProfiles(t, "testdata/cover_1.out"), &options{outputs: outputs, src: "covmerge/testdata/module"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if data, _ := os.ReadFile(coverFile); string(data) != "stale" {
+		t.Errorf("expected stale file to be kept, got %q", data)
+	}
+	if _, err := os.Stat(funcFile); !os.IsNotExist(err) {
+		t.Error("expected no func output", err)
+	}
+
+	assertNoTemps(t, dir)
+}
+
+func TestWriteOutputsMissingDir(t *testing.T) {
+	outputs := []output{{format: formatCover, path: filepath.Join(t.TempDir(), "missing", "cover.out")}}
+	if err := writeOutputs(loadProfiles(t, "testdata/cover_1.out"), &options{outputs: outputs, src: "."}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func assertNoTemps(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Error("temporary file left behind", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const commandPatch = "patch"
+
+// errNoDiff reports a patch command given neither -diff nor -base.
+var errNoDiff = errors.New("either -diff or -base is required")
+
+// errStdinTwice reports -diff - given with a - profile.
+var errStdinTwice = errors.New("-diff - cannot be used with a - profile, stdin can only be read once")
+
+// gitCommand is the git command used to produce diffs.
+var gitCommand = "git"
+
+const patchUsage = `usage: gocovdedup patch [options] <file1> <file2> ... <fileN>
+reports the coverage of the lines added by a unified diff
+the diff is read from -diff or produced by running git diff from the merge base of -base and HEAD`
+
+// patchOptions holds the settings of the patch command.
+type patchOptions struct {
+	options
+	diff string
+	base string
+	min  float64
+}
+
+// processPatchArgs parses the patch command line, returning the deduplicated
+// profiles merged with the shared merge options, where - reads stdIn.
+func processPatchArgs(args []string, stdIn io.Reader) (*patchOptions, []*cover.Profile, error) {
+	opts := &patchOptions{}
+	flags := newMergeFlags("gocovdedup patch", &opts.options)
+	flags.StringVar(&opts.diff, "diff", "", "read the unified diff from `file`, - reads stdin")
+	flags.StringVar(&opts.base, "base", "", "git `ref` the change branched from, used when -diff is not given")
+	flags.Float64Var(&opts.min, "min", 0, "fail when the patch coverage is below `percent`")
+
+	if err := parseFlags(patchUsage, flags, args); err != nil {
+		return nil, nil, err
+	}
+
+	if flags.NArg() == 0 {
+		return nil, nil, usage(patchUsage, flags, errNoProfiles)
+	}
+
+	if opts.diff == "" && opts.base == "" {
+		return nil, nil, usage(patchUsage, flags, errNoDiff)
+	}
+
+	if _, readStdin := splitStdin(flags.Args()); readStdin && opts.diff == stdoutPath {
+		return nil, nil, usage(patchUsage, flags, errStdinTwice)
+	}
+
+	if opts.min < 0 || opts.min > 100 {
+		return nil, nil, fmt.Errorf("invalid coverage percentage %v", opts.min)
+	}
+
+	merger, err := newMerger(&opts.options, flags.Args(), stdIn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profiles, err := merger.Merge()
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, profiles, nil
+}
+
+// parseDiff returns the lines added to each file by a unified diff, keyed by
+// the file's path in the new tree.  The a/ and b/ prefixes used by git are
+// removed and deleted files are skipped.
+func parseDiff(r io.Reader) (map[string][]int, error) {
+	added := make(map[string][]int)
+
+	var file string
+	var line, remaining int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+
+		if remaining > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				if file != "" {
+					added[file] = append(added[file], line)
+				}
+				line++
+				remaining--
+			case strings.HasPrefix(text, " "), text == "":
+				line++
+				remaining--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = diffPath(strings.TrimPrefix(text, "+++ "))
+		case strings.HasPrefix(text, "@@ "):
+			var err error
+			line, remaining, err = parseHunk(text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// diffPath extracts the path from a +++ file header.
+func diffPath(header string) string {
+	if i := strings.IndexByte(header, '\t'); i >= 0 {
+		header = header[:i]
+	}
+	if strings.HasPrefix(header, `"`) {
+		if unquoted, err := strconv.Unquote(header); err == nil {
+			header = unquoted
+		}
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(header, "b/")
+}
+
+// parseHunk returns the first line and line count of the new side of a hunk header.
+func parseHunk(header string) (line, count int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+
+	start, length, found := strings.Cut(fields[2][1:], ",")
+	count = 1
+	if found {
+		count, err = strconv.Atoi(length)
+	}
+	if err == nil {
+		line, err = strconv.Atoi(start)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+	return line, count, nil
+}
+
+// runGit runs a git command in dir, returning its output.
+func runGit(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(gitCommand, append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitTopLevel returns the root of the git repository containing dir.
+func gitTopLevel(dir string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// gitDiff returns the diff of the working tree containing dir against the
+// merge base of base and HEAD, so changes made on base since are not counted.
+func gitDiff(dir, base string) ([]byte, error) {
+	out, err := runGit(dir, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	mergeBase := strings.TrimSpace(string(out))
+	return runGit(dir, "diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "-U0", mergeBase, "--")
+}
+
+// patchFile is the coverage of the lines a diff adds to a file.
+type patchFile struct {
+	name           string
+	covered, total int
+	uncovered      []lineRange
+}
+
+// patchCoverage finds the instrumented lines added to each profile's file.
+// Diff paths are relative to root and are mapped to profile file names
+// through the module of resolver.  Added lines without statements are ignored.
+func patchCoverage(profiles []*cover.Profile, added map[string][]int, root string, resolver *covmerge.Resolver) []patchFile {
+	byName := make(map[string]*cover.Profile, len(profiles))
+	for _, profile := range profiles {
+		byName[profile.FileName] = profile
+	}
+
+	var files []patchFile
+	for path, lines := range added {
+		abs := filepath.Join(root, filepath.FromSlash(path))
+		profile := byName[filepath.ToSlash(abs)]
+		if rel, err := filepath.Rel(resolver.Root(), abs); profile == nil && err == nil && !strings.HasPrefix(rel, "..") {
+			profile = byName[resolver.ModulePath()+"/"+filepath.ToSlash(rel)]
+		}
+		if profile == nil {
+			continue
+		}
+
+		hits := make(map[int]int)
+		for _, hit := range covmerge.LineHits(profile) {
+			hits[hit.Line] = hit.Count
+		}
+
+		f := patchFile{name: profile.FileName}
+		var uncovered []int
+		for _, line := range lines {
+			count, found := hits[line]
+			if !found {
+				continue
+			}
+			f.total++
+			if count > 0 {
+				f.covered++
+			} else {
+				uncovered = append(uncovered, line)
+			}
+		}
+		if f.total > 0 {
+			f.uncovered = lineRanges(uncovered)
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files
+}
+
+// printPatch writes the patch coverage of each file and the total.
+func printPatch(files []patchFile, w io.Writer) (covered, total int) {
+	for _, f := range files {
+		fmt.Fprintf(w, "%s: %d/%d lines %.1f%%\n", f.name, f.covered, f.total, percent(f.covered, f.total))
+		if len(f.uncovered) > 0 {
+			fmt.Fprintf(w, "  uncovered lines: %s\n", joinRanges(f.uncovered))
+		}
+		covered += f.covered
+		total += f.total
+	}
+
+	if total == 0 {
+		fmt.Fprintln(w, "patch: no added statements")
+		return 0, 0
+	}
+	fmt.Fprintf(w, "patch: %d/%d lines %.1f%%\n", covered, total, percent(covered, total))
+	return covered, total
+}
+
+// readDiff reads the diff named by the -diff option, or runs git diff, returning
+// the added lines and the directory the diff paths are relative to.
+func readDiff(opts *patchOptions, resolver *covmerge.Resolver, stdin io.Reader) (map[string][]int, string, error) {
+	root, gitErr := gitTopLevel(opts.src)
+
+	var diff io.Reader
+	switch opts.diff {
+	case "":
+		if gitErr != nil {
+			return nil, "", gitErr
+		}
+		out, err := gitDiff(opts.src, opts.base)
+		if err != nil {
+			return nil, "", err
+		}
+		diff = bytes.NewReader(out)
+	case stdoutPath:
+		diff = stdin
+	default:
+		f, err := os.Open(opts.diff)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		diff = f
+	}
+
+	// outside a git repository the diff paths are taken to be module relative
+	if gitErr != nil {
+		root = resolver.Root()
+	}
+
+	added, err := parseDiff(diff)
+	return added, root, err
+}
+
+// runPatch runs the patch command, failing with a thresholdError when the
+// patch coverage is below the -min option.
+func runPatch(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, profiles, err := processPatchArgs(args, stdin)
+	if err != nil {
+		return err
+	}
+	printWarnings(opts.warnings, stderr)
+
+	resolver, err := covmerge.NewResolver(opts.src)
+	if err != nil {
+		return err
+	}
+
+	added, root, err := readDiff(opts, resolver, stdin)
+	if err != nil {
+		return err
+	}
+
+	covered, total := printPatch(patchCoverage(profiles, added, root, resolver), stdout)
+	if total > 0 && percent(covered, total) < opts.min {
+		return &thresholdError{violations: []string{
+			fmt.Sprintf("patch coverage %.1f%% is below the minimum %.1f%%", percent(covered, total), opts.min),
+		}}
+	}
+	return nil
+}
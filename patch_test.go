@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+)
+
+func TestParseDiff(t *testing.T) {
+	f, err := os.Open("covmerge/testdata/module/sample.diff")
+	if err != nil {
+		t.Fatal("open file", err)
+	}
+	defer f.Close()
+
+	added, err := parseDiff(f)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := map[string][]int{
+		"sample.go": {10, 11, 12, 28, 29, 30, 31},
+		"README.md": {2},
+	}
+	if !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected %v, got %v", expected, added)
+	}
+}
+
+func TestParseDiffContext(t *testing.T) {
+	diff := "--- old.go\t2023-01-01\n+++ new.go\t2023-01-02\n@@ -1,4 +1,5 @@\n package p\n-var a = 1\n+var a = 2\n+var b = 3\n\n func f() {}\n\\ No newline at end of file\n"
+
+	added, err := parseDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := map[string][]int{"new.go": {2, 3}}
+	if !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected %v, got %v", expected, added)
+	}
+}
+
+func TestParseDiffBadHunk(t *testing.T) {
+	if _, err := parseDiff(strings.NewReader("+++ b/a.go\n@@ -1 +x @@\n")); err == nil {
+		t.Error("expected hunk error")
+	}
+}
+
+func TestDiffPath(t *testing.T) {
+	testCases := []struct {
+		header   string
+		expected string
+	}{
+		{"b/pkg/a.go", "pkg/a.go"},
+		{"pkg/a.go\t2023-01-01 00:00:00", "pkg/a.go"},
+		{`"b/pkg/\303\244.go"`, "pkg/ä.go"},
+		{"/dev/null", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			if actual := diffPath(tc.header); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseHunk(t *testing.T) {
+	testCases := []struct {
+		header      string
+		line, count int
+	}{
+		{"@@ -1,2 +3,4 @@ func f() {", 3, 4},
+		{"@@ -1 +3 @@", 3, 1},
+		{"@@ -5,2 +4,0 @@", 4, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			line, count, err := parseHunk(tc.header)
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if line != tc.line || count != tc.count {
+				t.Errorf("expected %d,%d got %d,%d", tc.line, tc.count, line, count)
+			}
+		})
+	}
+}
+
+func TestPatchCoverageRoot(t *testing.T) {
+	_, profiles, err := processPatchArgs([]string{"patch", "-diff", "-", "covmerge/testdata/module/sample.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	resolver, err := covmerge.NewResolver("covmerge/testdata/module")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// diff paths relative to a repository root above the module
+	added := map[string][]int{"module/sample.go": {11, 64, 65}, "sample.go": {8}}
+	files := patchCoverage(profiles, added, filepath.Dir(resolver.Root()), resolver)
+
+	expected := []patchFile{{name: "example.com/sample/sample.go", covered: 1, total: 3, uncovered: []lineRange{{11, 11}, {65, 65}}}}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+}
+
+func TestRunPatch(t *testing.T) {
+	gitCommand = "testdata/notfound"
+	defer func() { gitCommand = "git" }()
+
+	testCases := []struct {
+		name     string
+		min      string
+		expected string
+		failed   bool
+	}{
+		{"pass", "60", "example.com/sample/sample.go: 3/5 lines 60.0%\n  uncovered lines: 11, 29\npatch: 3/5 lines 60.0%\n", false},
+		{"fail", "70", "example.com/sample/sample.go: 3/5 lines 60.0%\n  uncovered lines: 11, 29\npatch: 3/5 lines 60.0%\n", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			args := []string{"patch", "-src", "covmerge/testdata/module", "-diff", "covmerge/testdata/module/sample.diff", "-min", tc.min, "covmerge/testdata/module/sample.out"}
+			err := runPatch(args, nil, &stdout, &bytes.Buffer{})
+
+			var threshold *thresholdError
+			if errors.As(err, &threshold) != tc.failed {
+				t.Errorf("unexpected threshold result %v", err)
+			}
+			if stdout.String() != tc.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tc.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunPatchStdin(t *testing.T) {
+	gitCommand = "testdata/notfound"
+	defer func() { gitCommand = "git" }()
+
+	var stdout bytes.Buffer
+	diff := "+++ b/sample.go\n@@ -1,0 +63,1 @@\n+func Must(err error) {\n"
+	args := []string{"patch", "-src", "covmerge/testdata/module", "-diff", "-", "-min", "100", "covmerge/testdata/module/sample.out"}
+	if err := runPatch(args, strings.NewReader(diff), &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if expected := "patch: no added statements\n"; stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+}
+
+func TestRunPatchGit(t *testing.T) {
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"go.mod", "sample.go", "sample.out"} {
+		data, err := os.ReadFile(filepath.Join("covmerge/testdata/module", name))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		writeFile(t, filepath.Join(dir, name), string(data))
+	}
+
+	commit := []string{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-a", "-m", "change"}
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	replace := func(old, new string) {
+		t.Helper()
+		data, _ := os.ReadFile(filepath.Join(dir, "sample.go"))
+		writeFile(t, filepath.Join(dir, "sample.go"), strings.Replace(string(data), old, new, 1))
+	}
+
+	git("init", "-q")
+	git("add", ".")
+	git(commit...)
+	git("branch", "base")
+	git("checkout", "-q", "-b", "work")
+
+	// a change on base after branching is not part of the patch
+	git("checkout", "-q", "base")
+	replace(`return "small"`, `return "tiny"`)
+	git(commit...)
+	git("checkout", "-q", "work")
+
+	replace(`panic(err)`, `panic(err) // changed`)
+
+	var stdout bytes.Buffer
+	args := []string{"patch", "-src", dir, "-base", "base", filepath.Join(dir, "sample.out")}
+	err := runPatch(args, nil, &stdout, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := "example.com/sample/sample.go: 0/1 lines 0.0%\n  uncovered lines: 65\npatch: 0/1 lines 0.0%\n"
+	if stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+
+	if _, err := gitDiff(dir, "missing-ref"); err == nil {
+		t.Error("expected bad ref error")
+	}
+}
+
+func TestRunPatchNoGit(t *testing.T) {
+	gitCommand = "testdata/notfound"
+	defer func() { gitCommand = "git" }()
+
+	args := []string{"patch", "-src", "covmerge/testdata/module", "-base", "main", "covmerge/testdata/module/sample.out"}
+	if err := runPatch(args, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected git error")
+	}
+}
+
+func TestProcessPatchArgsErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		args  []string
+		usage bool
+	}{
+		{"no files", []string{"patch"}, true},
+		{"help", []string{"patch", "-h"}, true},
+		{"bad flag", []string{"patch", "-bad", "a"}, true},
+		{"no diff or base", []string{"patch", "a"}, true},
+		{"stdin twice", []string{"patch", "-diff", "-", "a", "-"}, true},
+		{"bad mode", []string{"patch", "-base", "main", "-mode", "bad", "a"}, false},
+		{"bad min", []string{"patch", "-base", "main", "-min", "101", "a"}, false},
+		{"missing file", []string{"patch", "-base", "main", "testdata/missing.out"}, false},
+		{"bad merge", []string{"patch", "-base", "main", "-merge", "bad", "testdata/cover_1.out"}, false},
+		{"none included", []string{"patch", "-base", "main", "-include", "missing.go", "testdata/cover_1.out"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := processPatchArgs(tc.args, nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var usageErr *usageError
+			if errors.As(err, &usageErr) != tc.usage {
+				t.Errorf("unexpected usage %v: %v", tc.usage, err)
+			}
+		})
+	}
+}
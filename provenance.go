@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const formatProvenance = "provenance"
+
+// provenanceReport is the JSON provenance of the merged blocks.
+type provenanceReport struct {
+	Inputs []string         `json:"inputs"`
+	Files  []provenanceFile `json:"files"`
+}
+
+type provenanceFile struct {
+	FileName string            `json:"fileName"`
+	Blocks   []provenanceBlock `json:"blocks"`
+}
+
+// provenanceBlock is a merged block and the inputs that covered it.
+type provenanceBlock struct {
+	StartLine int      `json:"startLine"`
+	StartCol  int      `json:"startCol"`
+	EndLine   int      `json:"endLine"`
+	EndCol    int      `json:"endCol"`
+	NumStmt   int      `json:"numStmt"`
+	Count     int      `json:"count"`
+	HitBy     []string `json:"hitBy"`
+}
+
+// printProvenance creates a formatter writing, for every merged block, the
+// inputs with a covered block overlapping it.
+func printProvenance(inputs []covmerge.Input) formatter {
+	return func(profiles []*cover.Profile, w io.Writer) error {
+		report := provenanceReport{
+			Inputs: make([]string, len(inputs)),
+			Files:  make([]provenanceFile, 0, len(profiles)),
+		}
+		for i, in := range inputs {
+			report.Inputs[i] = in.Name
+		}
+
+		for _, profile := range profiles {
+			file := provenanceFile{
+				FileName: profile.FileName,
+				Blocks:   make([]provenanceBlock, 0, len(profile.Blocks)),
+			}
+			for i := range profile.Blocks {
+				b := &profile.Blocks[i]
+				block := provenanceBlock{
+					StartLine: b.StartLine,
+					StartCol:  b.StartCol,
+					EndLine:   b.EndLine,
+					EndCol:    b.EndCol,
+					NumStmt:   b.NumStmt,
+					Count:     b.Count,
+					HitBy:     []string{},
+				}
+				for _, in := range inputs {
+					if in.Hits(profile.FileName, b) {
+						block.HitBy = append(block.HitBy, in.Name)
+					}
+				}
+				file.Blocks = append(file.Blocks, block)
+			}
+			report.Files = append(report.Files, file)
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+}
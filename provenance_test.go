@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestProvenance(t *testing.T) {
+	dir := t.TempDir()
+	unit := filepath.Join(dir, "unit.out")
+	integration := filepath.Join(dir, "integration.out")
+	writeFile(t, unit, "mode: set\nexample.com/p/a.go:1.1,2.2 1 1\nexample.com/p/a.go:3.1,4.2 1 0\nexample.com/p/a.go:5.1,6.2 1 0\n")
+	writeFile(t, integration, "mode: set\nexample.com/p/a.go:1.1,2.2 1 1\nexample.com/p/a.go:3.1,4.2 1 1\nexample.com/p/a.go:5.1,6.2 1 0\n")
+
+	opts, profiles, err := mergeArgs([]string{"app", "-format", "provenance", unit, integration}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOutputs(profiles, opts, &buf); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var report provenanceReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if expected := []string{unit, integration}; !reflect.DeepEqual(report.Inputs, expected) {
+		t.Errorf("expected inputs %v, got %v", expected, report.Inputs)
+	}
+	if len(report.Files) != 1 || len(report.Files[0].Blocks) != 3 {
+		t.Fatal("unexpected report", report)
+	}
+
+	expected := [][]string{{unit, integration}, {integration}, {}}
+	for i, block := range report.Files[0].Blocks {
+		if !reflect.DeepEqual(block.HitBy, expected[i]) {
+			t.Errorf("block %d expected %v, got %v", i, expected[i], block.HitBy)
+		}
+	}
+}
+
+func TestProvenanceRewriteAndStdin(t *testing.T) {
+	stdin := strings.NewReader("mode: set\ngithub.com/repo/gocovdedup/main.go:1.1,2.2 1 1\n")
+
+	args := []string{
+		"app",
+		"-rewrite", "github.com/repo/gocovdedup=example.com/gocovdedup",
+		"-o", "provenance=" + filepath.Join(t.TempDir(), "provenance.json"),
+		"-", "testdata/cover_1.out",
+	}
+	opts, _, err := processArgs(args, stdin)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(opts.inputs) != 2 || opts.inputs[0].Name != "stdin" || opts.inputs[1].Name != "testdata/cover_1.out" {
+		t.Fatal("unexpected inputs", opts.inputs)
+	}
+	block := &cover.ProfileBlock{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1}
+	if !opts.inputs[0].Hits("example.com/gocovdedup/main.go", block) {
+		t.Error("expected rewritten file name")
+	}
+}
+
+func TestProvenanceNotTracked(t *testing.T) {
+	opts, _, err := processArgs([]string{"app", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if opts.inputs != nil {
+		t.Error("unexpected provenance tracking")
+	}
+}
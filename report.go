@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const commandReport = "report"
+
+const reportUsage = `usage: gocovdedup report [options] [<file1> <file2> ... <fileN>|-]
+prints the statement coverage of each package or file of the merged profiles`
+
+// Report groupings.
+const (
+	reportByPackage = "package"
+	reportByFile    = "file"
+)
+
+// processReportArgs parses the report command line, returning the merger
+// holding the profiles.
+func processReportArgs(args []string, stdIn io.Reader) (*options, *covmerge.Merger, error) {
+	opts := &options{}
+	flags := newMergeFlags("gocovdedup report", opts)
+	flags.StringVar(&opts.by, "by", reportByPackage, "report the coverage of each `package` or file")
+
+	if err := parseFlags(reportUsage, flags, args); err != nil {
+		return nil, nil, err
+	}
+
+	if flags.NArg() == 0 {
+		return nil, nil, usage(reportUsage, flags, errNoProfiles)
+	}
+
+	if opts.by != reportByPackage && opts.by != reportByFile {
+		return nil, nil, usage(reportUsage, flags, fmt.Errorf("unknown report grouping %q", opts.by))
+	}
+
+	merger, err := newMerger(opts, flags.Args(), stdIn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, merger, nil
+}
+
+// printReport writes the covered and total statements of each package, or
+// each file when byFile is set, followed by the total.
+func printReport(profiles []*cover.Profile, byFile bool, w io.Writer) error {
+	tabber := tabwriter.NewWriter(w, 1, 8, 2, ' ', 0)
+
+	heading := reportByPackage
+	if byFile {
+		heading = reportByFile
+	}
+	fmt.Fprintf(tabber, "%s\tcovered\tstatements\tcoverage\n", heading)
+
+	var total stmtCount
+	if byFile {
+		for _, profile := range profiles {
+			var file stmtCount
+			file.add(profile)
+			total.add(profile)
+			fmt.Fprintf(tabber, "%s\t%d\t%d\t%.1f%%\n", profile.FileName, file.covered, file.total, file.percent())
+		}
+	} else {
+		names, packages := packageCounts(fileCounts(profiles))
+		for _, name := range names {
+			pkg := packages[name]
+			total.covered += pkg.covered
+			total.total += pkg.total
+			fmt.Fprintf(tabber, "%s\t%d\t%d\t%.1f%%\n", name, pkg.covered, pkg.total, pkg.percent())
+		}
+	}
+	fmt.Fprintf(tabber, "total\t%d\t%d\t%.1f%%\n", total.covered, total.total, total.percent())
+
+	return tabber.Flush()
+}
+
+// runReport runs the report command.
+func runReport(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, merger, err := processReportArgs(args, stdin)
+	if err != nil {
+		return err
+	}
+
+	merged, err := merger.Merge()
+	printWarnings(opts.warnings, stderr)
+	if err != nil {
+		return err
+	}
+
+	return printReport(merged, opts.by == reportByFile, stdout)
+}
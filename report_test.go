@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRunReport(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "package",
+			args: []string{"report", "covmerge/testdata/module/sample.out", "testdata/cover_2.out"},
+			expected: `package                     covered  statements  coverage
+example.com/sample          25       31          80.6%
+github.com/repo/gocovdedup  22       59          37.3%
+total                       47       90          52.2%
+`,
+		},
+		{
+			name: "file",
+			args: []string{"report", "-by", "file", "covmerge/testdata/module/sample.out"},
+			expected: `file                          covered  statements  coverage
+example.com/sample/sample.go  25       31          80.6%
+total                         25       31          80.6%
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := runReport(tc.args, nil, &stdout, &bytes.Buffer{}); err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if stdout.String() != tc.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tc.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestProcessReportArgsErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{"no files", []string{"report"}},
+		{"bad by", []string{"report", "-by", "func", "testdata/cover_1.out"}},
+		{"missing file", []string{"report", "testdata/missing.out"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := processReportArgs(tc.args, nil); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+)
+
+// rewritesFlag collects repeated from=to rewrite flag values.  The prefix and
+// regular expression flags share one list so rules apply in command line order.
+type rewritesFlag struct {
+	rules  *[]covmerge.Rewrite
+	regexp bool
+}
+
+// String implements flag.Value.
+func (f *rewritesFlag) String() string {
+	if f.rules == nil {
+		return ""
+	}
+	values := make([]string, 0, len(*f.rules))
+	for _, r := range *f.rules {
+		if r.IsRegexp() == f.regexp {
+			values = append(values, r.String())
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// Set implements flag.Value.
+func (f *rewritesFlag) Set(value string) error {
+	from, to, found := strings.Cut(value, "=")
+	if !found || from == "" {
+		return fmt.Errorf("invalid rewrite %q, expected from=to", value)
+	}
+
+	r := covmerge.PrefixRewrite(from, to)
+	if f.regexp {
+		var err error
+		if r, err = covmerge.RegexpRewrite(from, to); err != nil {
+			return fmt.Errorf("invalid rewrite %q: %w", value, err)
+		}
+	}
+
+	*f.rules = append(*f.rules, r)
+	return nil
+}
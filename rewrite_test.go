@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+)
+
+func TestRewritesFlagErrors(t *testing.T) {
+	testCases := [][]string{
+		{"-rewrite", "noequals"},
+		{"-rewrite", "=to"},
+		{"-rewrite-regexp", "(=x"},
+	}
+
+	for _, args := range testCases {
+		t.Run(args[1], func(t *testing.T) {
+			var rules []covmerge.Rewrite
+			flags := newRewriteFlags(&rules)
+			if err := flags.Parse(args); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestRewritesFlagString(t *testing.T) {
+	var rules []covmerge.Rewrite
+	flags := newRewriteFlags(&rules)
+	if err := flags.Parse([]string{"-rewrite", "a=b", "-rewrite-regexp", "^c=d", "-rewrite", "e=f"}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if actual := flags.Lookup("rewrite").Value.String(); actual != "a=b,e=f" {
+		t.Errorf("unexpected prefix rules %q", actual)
+	}
+	if actual := flags.Lookup("rewrite-regexp").Value.String(); actual != "^c=d" {
+		t.Errorf("unexpected regexp rules %q", actual)
+	}
+	if actual := (&rewritesFlag{}).String(); actual != "" {
+		t.Errorf("unexpected zero value %q", actual)
+	}
+}
+
+func TestProcessArgsRewrite(t *testing.T) {
+	args := []string{
+		"app",
+		"-rewrite", "github.com/repo/gocovdedup=example.com/gocovdedup",
+		"testdata/cover_1.out",
+		"testdata/cover_2.out",
+	}
+	_, p, err := mergeArgs(args, nil)
+	if err != nil {
+		t.Fatal("unexpected err", err)
+	}
+
+	expected := []string{"example.com/gocovdedup/main.go"}
+	if actual := fileNames(p); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func newRewriteFlags(rules *[]covmerge.Rewrite) *flag.FlagSet {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&rewritesFlag{rules: rules}, "rewrite", "")
+	flags.Var(&rewritesFlag{rules: rules, regexp: true}, "rewrite-regexp", "")
+	return flags
+}
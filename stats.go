@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+const commandStats = "stats"
+
+const statsUsage = `usage: gocovdedup stats [options] [<file1> <file2> ... <fileN>|-]
+prints the number of inputs, profiles and blocks read and the size and coverage of the merged profiles`
+
+// readCounts counts the inputs, file profiles and blocks read before merging.
+type readCounts struct {
+	inputs, profiles, blocks int
+}
+
+func (c *readCounts) add(profiles []*cover.Profile) {
+	c.inputs++
+	c.profiles += len(profiles)
+	for _, profile := range profiles {
+		c.blocks += len(profile.Blocks)
+	}
+}
+
+// processStatsArgs parses the stats command line, returning the merger
+// holding the profiles.
+func processStatsArgs(args []string, stdIn io.Reader) (*options, *covmerge.Merger, error) {
+	opts := &options{}
+	flags := newMergeFlags("gocovdedup stats", opts)
+
+	if err := parseFlags(statsUsage, flags, args); err != nil {
+		return nil, nil, err
+	}
+
+	if flags.NArg() == 0 {
+		return nil, nil, usage(statsUsage, flags, errNoProfiles)
+	}
+
+	merger, err := newMerger(opts, flags.Args(), stdIn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, merger, nil
+}
+
+// printStats writes what was read and what the merge produced.
+func printStats(read readCounts, profiles []*cover.Profile, w io.Writer) error {
+	var total stmtCount
+	blocks := 0
+	for _, profile := range profiles {
+		total.add(profile)
+		blocks += len(profile.Blocks)
+	}
+
+	tabber := tabwriter.NewWriter(w, 1, 8, 2, ' ', 0)
+	fmt.Fprintf(tabber, "inputs\t%d\n", read.inputs)
+	fmt.Fprintf(tabber, "profiles read\t%d\n", read.profiles)
+	fmt.Fprintf(tabber, "blocks read\t%d\n", read.blocks)
+	fmt.Fprintf(tabber, "files\t%d\n", len(profiles))
+	fmt.Fprintf(tabber, "blocks\t%d\n", blocks)
+	fmt.Fprintf(tabber, "statements\t%d\n", total.total)
+	fmt.Fprintf(tabber, "covered\t%d\n", total.covered)
+	fmt.Fprintf(tabber, "coverage\t%.1f%%\n", total.percent())
+	return tabber.Flush()
+}
+
+// runStats runs the stats command.
+func runStats(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, merger, err := processStatsArgs(args, stdin)
+	if err != nil {
+		return err
+	}
+
+	merged, err := merger.Merge()
+	printWarnings(opts.warnings, stderr)
+	if err != nil {
+		return err
+	}
+
+	return printStats(opts.read, merged, stdout)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunStats(t *testing.T) {
+	stdin := strings.NewReader("mode: set\nexample.com/sample/sample.go:7.29,8.11 1 1\n")
+
+	var stdout bytes.Buffer
+	args := []string{"stats", "-", "covmerge/testdata/module/sample.out", "covmerge/testdata/module/baseline.out"}
+	if err := runStats(args, stdin, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := `inputs         3
+profiles read  4
+blocks read    56
+files          2
+blocks         28
+statements     33
+covered        29
+coverage       87.9%
+`
+	if stdout.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, stdout.String())
+	}
+}
+
+func TestProcessStatsArgsNoFiles(t *testing.T) {
+	if _, _, err := processStatsArgs([]string{"stats"}, nil); err == nil {
+		t.Error("expected usage error")
+	}
+}
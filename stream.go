@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nehemming/gocovdedup/covmerge"
+	"golang.org/x/tools/cover"
+)
+
+// streamFormatter writes the merged profiles one at a time as they are
+// merged, and is called with a nil profile after the last one.
+type streamFormatter func(profile *cover.Profile, w io.Writer)
+
+// newStreamFormatter creates the streaming formatter of an output format,
+// returning false for formats that need every merged profile at once.
+// Source files are named through resolver as the formatters do.
+func newStreamFormatter(format string, resolver *covmerge.Resolver) (streamFormatter, bool) {
+	started := false
+	switch format {
+	case formatCover:
+		return func(profile *cover.Profile, w io.Writer) {
+			if profile == nil {
+				return
+			}
+			if !started {
+				fmt.Fprintf(w, "mode: %s\n", profile.Mode)
+				started = true
+			}
+			printProfile(profile, w)
+		}, true
+	case formatLCOV:
+		return func(profile *cover.Profile, w io.Writer) {
+			if !started {
+				fmt.Fprintln(w, "TN:")
+				started = true
+			}
+			if profile != nil {
+				printLCOVRecord(profile, resolver, w)
+			}
+		}, true
+	}
+	return nil, false
+}
+
+// streamsOutputs reports whether every output can be written as the
+// profiles are merged.
+func (opts *options) streamsOutputs() bool {
+	for _, o := range opts.outputs {
+		if _, ok := newStreamFormatter(o.format, nil); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// outputStream is an output being written as the profiles are merged.
+type outputStream struct {
+	output
+	format streamFormatter
+	w      *bufio.Writer
+	file   *os.File
+}
+
+// streamOutputs merges the profiles a file at a time, writing each to the
+// outputs as it is merged, and returns the statement counts of the merged
+// files.  Files are written to temporary files and renamed into place as
+// writeOutputs does, but stdout receives the files merged before a failure.
+func streamOutputs(merger *covmerge.Merger, opts *options, stdout io.Writer) (files []fileCount, err error) {
+	streams, err := openStreams(opts.outputs, outputResolver(opts.src), stdout)
+	defer func() {
+		for _, s := range streams {
+			if s.file != nil && err != nil {
+				s.file.Close()
+				os.Remove(s.file.Name())
+			}
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	err = merger.MergeEach(func(profile *cover.Profile) error {
+		files = append(files, fileCounts([]*cover.Profile{profile})...)
+		for _, s := range streams {
+			s.format(profile, s.w)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	temps := make(map[string]string, len(streams))
+	for _, s := range streams {
+		s.format(nil, s.w)
+		err = s.w.Flush()
+		if s.file != nil {
+			err = closeTemp(s.file, s.path, err)
+			temps[s.path] = s.file.Name()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, renameTemps(opts.outputs, temps)
+}
+
+// openStreams opens the outputs, creating a temporary file for each file
+// output.  The streams opened are returned along with any error.
+func openStreams(outputs []output, resolver *covmerge.Resolver, stdout io.Writer) ([]*outputStream, error) {
+	streams := make([]*outputStream, 0, len(outputs))
+	for _, o := range outputs {
+		format, ok := newStreamFormatter(o.format, resolver)
+		if !ok {
+			return streams, fmt.Errorf("output format %q cannot be streamed", o.format)
+		}
+
+		s := &outputStream{output: o, format: format}
+		if o.path == stdoutPath {
+			s.w = bufio.NewWriter(stdout)
+		} else {
+			f, err := openTemp(o.path)
+			if err != nil {
+				return streams, err
+			}
+			s.file, s.w = f, bufio.NewWriter(f)
+		}
+		streams = append(streams, s)
+	}
+	return streams, nil
+}
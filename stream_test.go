@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunMergeMaxBlocks(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{"cover", []string{"testdata/cover_1.out", "testdata/cover_2.out", "covmerge/testdata/module/sample.out"}},
+		{"lcov", []string{"-format", "lcov", "testdata/cover_1.out", "testdata/cover_2.out"}},
+		{"func", []string{"-format", "func", "-src", "covmerge/testdata/module", "covmerge/testdata/module/sample.out"}},
+		{"thresholds", []string{"-min-file", "50", "testdata/cover_2.out", "covmerge/testdata/module/sample.out"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expected bytes.Buffer
+			expectedErr := runMerge(append([]string{"app"}, tc.args...), nil, &expected, &bytes.Buffer{})
+
+			var stdout bytes.Buffer
+			err := runMerge(append([]string{"app", "-max-blocks", "2"}, tc.args...), nil, &stdout, &bytes.Buffer{})
+			if (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+				t.Errorf("expected %v, got %v", expectedErr, err)
+			}
+			if stdout.String() != expected.String() {
+				t.Errorf("expected\n%s\ngot\n%s", expected.String(), stdout.String())
+			}
+		})
+	}
+}
+
+func TestStreamOutputs(t *testing.T) {
+	dir := t.TempDir()
+	coverFile := filepath.Join(dir, "cover.out")
+	lcovFile := filepath.Join(dir, "cover.info")
+	writeFile(t, coverFile, "stale")
+
+	files := []string{"testdata/cover_1.out", "testdata/cover_2.out"}
+	args := append([]string{"app", "-max-blocks", "3", "-o", coverFile, "-o", "lcov=" + lcovFile}, files...)
+	if err := runMerge(args, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, format := range []string{"cover", "lcov"} {
+		var expected bytes.Buffer
+		if err := runMerge(append([]string{"app", "-format", format}, files...), nil, &expected, &bytes.Buffer{}); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		file := coverFile
+		if format == "lcov" {
+			file = lcovFile
+		}
+		if data, _ := os.ReadFile(file); string(data) != expected.String() {
+			t.Errorf("%s: expected\n%s\ngot\n%s", format, expected.String(), data)
+		}
+	}
+
+	assertNoTemps(t, dir)
+}
+
+func TestStreamOutputsMissingDir(t *testing.T) {
+	dir := t.TempDir()
+	coverFile := filepath.Join(dir, "cover.out")
+	missing := filepath.Join(dir, "missing", "cover.info")
+	spill := t.TempDir()
+	t.Setenv("TMPDIR", spill)
+
+	args := []string{"app", "-max-blocks", "3", "-o", coverFile, "-o", "lcov=" + missing, "testdata/cover_1.out"}
+	if err := runMerge(args, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(coverFile); !os.IsNotExist(err) {
+		t.Error("expected no cover output", err)
+	}
+
+	assertNoTemps(t, dir)
+	if entries, _ := os.ReadDir(spill); len(entries) != 0 {
+		t.Errorf("expected spilled blocks removed, found %v", entries)
+	}
+}
+
+func TestProcessArgsMaxBlocksErrors(t *testing.T) {
+	_, _, err := processArgs([]string{"app", "-max-blocks", "-1", "testdata/cover_1.out"}, nil)
+	var usageErr *usageError
+	if !errors.As(err, &usageErr) {
+		t.Errorf("expected usage error, got %v", err)
+	}
+
+	if _, _, err := processArgs([]string{"app", "-max-blocks", "10", "-format", "provenance", "testdata/cover_1.out"}, nil); err == nil {
+		t.Error("expected provenance error")
+	}
+}
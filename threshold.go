@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// threshold is a minimum statement coverage percentage for the packages or
+// files matching pattern.  An empty pattern matches everything.
+type threshold struct {
+	pattern string
+	min     float64
+}
+
+// matches reports whether name matches the threshold pattern.  A pattern
+// ending in /... matches the path and everything below it, otherwise the
+// pattern is matched using path.Match.
+func (t threshold) matches(name string) bool {
+	if t.pattern == "" {
+		return true
+	}
+	if prefix := strings.TrimSuffix(t.pattern, "/..."); prefix != t.pattern {
+		return name == prefix || strings.HasPrefix(name, prefix+"/")
+	}
+	matched, _ := path.Match(t.pattern, name)
+	return matched
+}
+
+// thresholdsFlag collects repeated [pattern=]percent flag values.
+type thresholdsFlag []threshold
+
+// String implements flag.Value.
+func (f *thresholdsFlag) String() string {
+	values := make([]string, 0, len(*f))
+	for _, t := range *f {
+		value := strconv.FormatFloat(t.min, 'f', -1, 64)
+		if t.pattern != "" {
+			value = t.pattern + "=" + value
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, ",")
+}
+
+// Set implements flag.Value.
+func (f *thresholdsFlag) Set(value string) error {
+	var t threshold
+	minimum := value
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		t.pattern, minimum = value[:i], value[i+1:]
+	}
+
+	var err error
+	t.min, err = parsePercent(minimum)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, t)
+	return nil
+}
+
+// parsePercent parses a percentage between 0 and 100.
+func parsePercent(value string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, fmt.Errorf("invalid coverage percentage %q", value)
+	}
+	return p, nil
+}
+
+// thresholdError reports the coverage minimums that were not met.
+type thresholdError struct {
+	violations []string
+}
+
+func (e *thresholdError) Error() string {
+	return "coverage below minimum:\n  " + strings.Join(e.violations, "\n  ")
+}
+
+// stmtCount is a count of covered and total statements.
+type stmtCount struct {
+	covered, total int
+}
+
+func (c *stmtCount) add(profile *cover.Profile) {
+	for _, block := range profile.Blocks {
+		c.total += block.NumStmt
+		if block.Count > 0 {
+			c.covered += block.NumStmt
+		}
+	}
+}
+
+func (c stmtCount) percent() float64 {
+	return percent(c.covered, c.total)
+}
+
+// fileCount is the statement count of a merged file.
+type fileCount struct {
+	name string
+	stmtCount
+}
+
+// fileCounts counts the statements of each profile.
+func fileCounts(profiles []*cover.Profile) []fileCount {
+	files := make([]fileCount, len(profiles))
+	for i, profile := range profiles {
+		files[i].name = profile.FileName
+		files[i].add(profile)
+	}
+	return files
+}
+
+// packageCounts counts the statements of each package, the directory of
+// each file name, returning the package names in order.
+func packageCounts(files []fileCount) ([]string, map[string]*stmtCount) {
+	packages := make(map[string]*stmtCount)
+	for _, file := range files {
+		name := path.Dir(file.name)
+		pkg, found := packages[name]
+		if !found {
+			pkg = &stmtCount{}
+			packages[name] = pkg
+		}
+		pkg.covered += file.covered
+		pkg.total += file.total
+	}
+
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, packages
+}
+
+// checkThresholds checks the statement coverage of the merged files against
+// the minimums, returning a thresholdError listing every violation.
+func checkThresholds(files []fileCount, minTotal float64, minPackage, minFile []threshold) error {
+	var violations []string
+
+	var total stmtCount
+	for _, file := range files {
+		total.covered += file.covered
+		total.total += file.total
+
+		violations = append(violations, violated("file", file.name, file.stmtCount, minFile)...)
+	}
+
+	names, packages := packageCounts(files)
+	for _, name := range names {
+		violations = append(violations, violated("package", name, *packages[name], minPackage)...)
+	}
+
+	if total.percent() < minTotal {
+		violations = append(violations, fmt.Sprintf("total coverage %.1f%% is below the minimum %.1f%%", total.percent(), minTotal))
+	}
+
+	if len(violations) > 0 {
+		return &thresholdError{violations: violations}
+	}
+	return nil
+}
+
+// violated describes each threshold matching name that count falls below.
+// Anything without statements cannot be covered, so it is never reported.
+func violated(kind, name string, count stmtCount, thresholds []threshold) []string {
+	if count.total == 0 {
+		return nil
+	}
+
+	var violations []string
+	for _, t := range thresholds {
+		if t.matches(name) && count.percent() < t.min {
+			violations = append(violations, fmt.Sprintf("%s %s coverage %.1f%% is below the minimum %.1f%%", kind, name, count.percent(), t.min))
+		}
+	}
+	return violations
+}
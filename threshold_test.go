@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestThresholdMatches(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"", "github.com/repo/a", true},
+		{"github.com/repo/a", "github.com/repo/a", true},
+		{"github.com/repo/a", "github.com/repo/ab", false},
+		{"github.com/repo/...", "github.com/repo", true},
+		{"github.com/repo/...", "github.com/repo/a/b", true},
+		{"github.com/repo/...", "github.com/repository", false},
+		{"github.com/repo/*.go", "github.com/repo/main.go", true},
+		{"github.com/repo/*.go", "github.com/repo/a/main.go", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			if actual := (threshold{pattern: tc.pattern}).matches(tc.name); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestThresholdsFlag(t *testing.T) {
+	var f thresholdsFlag
+	for _, value := range []string{"80", "github.com/repo/...=65.5", "a.go=90%"} {
+		if err := f.Set(value); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	expected := thresholdsFlag{{"", 80}, {"github.com/repo/...", 65.5}, {"a.go", 90}}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("expected %v, got %v", expected, f)
+	}
+
+	if s := f.String(); s != "80,github.com/repo/...=65.5,a.go=90" {
+		t.Errorf("unexpected string %s", s)
+	}
+
+	for _, value := range []string{"", "x", "a=101", "a=-1"} {
+		if err := f.Set(value); err == nil {
+			t.Error("expected error for", value)
+		}
+	}
+}
+
+func thresholdProfiles() []*cover.Profile {
+	return []*cover.Profile{
+		{FileName: "github.com/repo/a/one.go", Blocks: []cover.ProfileBlock{
+			{NumStmt: 3, Count: 1},
+			{NumStmt: 1, Count: 0},
+		}},
+		{FileName: "github.com/repo/a/two.go", Blocks: []cover.ProfileBlock{
+			{NumStmt: 4, Count: 0},
+		}},
+		{FileName: "github.com/repo/b/three.go", Blocks: []cover.ProfileBlock{
+			{NumStmt: 2, Count: 1},
+			{NumStmt: 0, Count: 0},
+		}},
+		{FileName: "github.com/repo/b/types.go"},
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	testCases := []struct {
+		name       string
+		minTotal   float64
+		minPackage []threshold
+		minFile    []threshold
+		expected   []string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "total met",
+			minTotal: 50,
+		},
+		{
+			name:     "total",
+			minTotal: 60,
+			expected: []string{"total coverage 50.0% is below the minimum 60.0%"},
+		},
+		{
+			name:       "package",
+			minPackage: []threshold{{"", 40}, {"github.com/repo/b", 100}},
+			expected:   []string{"package github.com/repo/a coverage 37.5% is below the minimum 40.0%"},
+		},
+		{
+			name:    "file",
+			minFile: []threshold{{"github.com/repo/a/*", 10}},
+			expected: []string{
+				"file github.com/repo/a/two.go coverage 0.0% is below the minimum 10.0%",
+			},
+		},
+		{
+			name:       "all",
+			minTotal:   100,
+			minPackage: []threshold{{"github.com/repo/...", 90}},
+			minFile:    []threshold{{"", 80}},
+			expected: []string{
+				"file github.com/repo/a/one.go coverage 75.0% is below the minimum 80.0%",
+				"file github.com/repo/a/two.go coverage 0.0% is below the minimum 80.0%",
+				"package github.com/repo/a coverage 37.5% is below the minimum 90.0%",
+				"total coverage 50.0% is below the minimum 100.0%",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkThresholds(fileCounts(thresholdProfiles()), tc.minTotal, tc.minPackage, tc.minFile)
+			if tc.expected == nil {
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+				return
+			}
+
+			var thresholdErr *thresholdError
+			if !errors.As(err, &thresholdErr) {
+				t.Fatal("expected threshold error", err)
+			}
+			if !reflect.DeepEqual(thresholdErr.violations, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, thresholdErr.violations)
+			}
+		})
+	}
+}
+
+func TestProcessArgsThresholds(t *testing.T) {
+	opts, _, err := processArgs([]string{"app", "-min", "75", "-min-package", "60", "-min-file", "a.go=50", "testdata/cover_1.out"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if opts.minTotal != 75 || len(opts.minPackage) != 1 || len(opts.minFile) != 1 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	if _, _, err := processArgs([]string{"app", "-min", "120", "testdata/cover_1.out"}, nil); err == nil {
+		t.Error("expected invalid percentage error")
+	}
+}
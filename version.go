@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+)
+
+const commandVersion = "version"
+
+const versionUsage = `usage: gocovdedup version
+prints the version of gocovdedup and the details recorded when it was built`
+
+// readBuildInfo returns the build information embedded in the binary.
+var readBuildInfo = debug.ReadBuildInfo
+
+// printVersion writes the module version, the Go version and the version
+// control details of the build.  Binaries built from a checkout rather than
+// installed by version report (devel).
+func printVersion(info *debug.BuildInfo, w io.Writer) error {
+	version := info.Main.Version
+	if version == "" {
+		version = "(devel)"
+	}
+
+	tabber := tabwriter.NewWriter(w, 1, 8, 2, ' ', 0)
+	fmt.Fprintf(tabber, "gocovdedup\t%s\n", version)
+	fmt.Fprintf(tabber, "go\t%s\n", info.GoVersion)
+	for _, setting := range info.Settings {
+		if name := strings.TrimPrefix(setting.Key, "vcs."); name != setting.Key && name != "" {
+			fmt.Fprintf(tabber, "%s\t%s\n", name, setting.Value)
+		}
+	}
+	return tabber.Flush()
+}
+
+// runVersion runs the version command.
+func runVersion(args []string, _ io.Reader, stdout, _ io.Writer) error {
+	flags := flag.NewFlagSet("gocovdedup version", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	if err := parseFlags(versionUsage, flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 0 {
+		return usage(versionUsage, flags, fmt.Errorf("unexpected arguments %s", strings.Join(flags.Args(), " ")))
+	}
+
+	info, ok := readBuildInfo()
+	if !ok {
+		return errors.New("build information is not available")
+	}
+	return printVersion(info, stdout)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"runtime/debug"
+	"testing"
+)
+
+func TestRunVersion(t *testing.T) {
+	defer func() { readBuildInfo = debug.ReadBuildInfo }()
+
+	testCases := []struct {
+		name     string
+		info     *debug.BuildInfo
+		expected string
+	}{
+		{
+			name: "release",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.22.1",
+				Main:      debug.Module{Path: "github.com/nehemming/gocovdedup", Version: "v1.4.0"},
+				Settings: []debug.BuildSetting{
+					{Key: "-trimpath", Value: "true"},
+					{Key: "vcs.revision", Value: "3b7f228"},
+					{Key: "vcs.modified", Value: "false"},
+				},
+			},
+			expected: "gocovdedup  v1.4.0\ngo          go1.22.1\nrevision    3b7f228\nmodified    false\n",
+		},
+		{
+			name:     "devel",
+			info:     &debug.BuildInfo{GoVersion: "go1.22.1"},
+			expected: "gocovdedup  (devel)\ngo          go1.22.1\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			readBuildInfo = func() (*debug.BuildInfo, bool) { return tc.info, true }
+
+			var stdout bytes.Buffer
+			if err := runVersion([]string{"version"}, nil, &stdout, &bytes.Buffer{}); err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if stdout.String() != tc.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tc.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunVersionErrors(t *testing.T) {
+	defer func() { readBuildInfo = debug.ReadBuildInfo }()
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+
+	if err := runVersion([]string{"version"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected missing build information error")
+	}
+	if err := runVersion([]string{"version", "extra"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected unexpected arguments error")
+	}
+}